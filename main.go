@@ -15,11 +15,24 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
@@ -27,37 +40,118 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/promslog"
 	"github.com/prometheus/common/version"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
 	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"sigs.k8s.io/yaml"
 )
 
 const (
-	appName            = "job-pod-reaper"
-	lifetimeAnnotation = "pod.kubernetes.io/lifetime"
-	metricsPath        = "/metrics"
-	metricsNamespace   = "job_pod_reaper"
+	appName                       = "job-pod-reaper"
+	lifetimeAnnotation            = "pod.kubernetes.io/lifetime"
+	expiresAtAnnotation           = "pod.kubernetes.io/expires-at"
+	basisAnnotation               = "job-pod-reaper/lifetime-basis"
+	extendByAnnotation            = "job-pod-reaper/extend-by"
+	extensionsAnnotation          = "job-pod-reaper/extensions"
+	extensionsRefusedAnnotation   = "job-pod-reaper/extensions-refused"
+	maxExtendedLifetimeAnnotation = "job-pod-reaper/max-extended-lifetime"
+	defaultLifetimeAnnotation     = "job-pod-reaper/default-lifetime"
+	maxLifetimeAnnotation         = "job-pod-reaper/max-lifetime"
+	expiresInAnnotation           = "job-pod-reaper/expires-in"
+	ttlAfterFinishedAnnotation    = "job-pod-reaper/ttl-after-finished"
+	reapMaxAnnotation             = "job-pod-reaper/reap-max"
+	reasonLifetime                = "lifetime"
+	reasonFinished                = "finished"
+	reasonPending                 = "pending"
+	reasonUnschedulable           = "unschedulable"
+	reasonEvicted                 = "evicted"
+	reasonOOMKilled               = "oomkilled"
+	reasonRestarts                = "restarts"
+	reasonCrashLoop               = "crashloop"
+	reasonOrphaned                = "orphaned"
+	metricsPath                   = "/metrics"
+	metricsNamespace              = "job_pod_reaper"
+	serviceAccountNamespaceFile   = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// crashLoopResetAfter is twice the kubelet's maximum CrashLoopBackOff delay.
+	crashLoopResetAfter = 10 * time.Minute
 )
 
 var (
-	runOnce         = kingpin.Flag("run-once", "Set application to run once then exit, ie executed with cron").Default("false").Envar("RUN_ONCE").Bool()
-	reapMax         = kingpin.Flag("reap-max", "Maximum Pods to reap in each run, set to 0 to disable this limit").Default("30").Envar("REAP_MAX").Int()
-	reapInterval    = kingpin.Flag("reap-interval", "Duration between repear runs").Default("60s").Envar("REAP_INTERLVAL").Duration()
-	reapNamespaces  = kingpin.Flag("reap-namespaces", "Namespaces to reap, ignored if --namespace-labels is set").Default("all").Envar("REAP_NAMESPACES").String()
-	namespaceLabels = kingpin.Flag("namespace-labels", "Labels to use when filtering namespaces, causes --namespace-labels to be ignored").Default("").Envar("NAMESPACE_LABELS").String()
-	objectLabels    = kingpin.Flag("object-labels", "Labels to use when filtering objects").Default("").Envar("OBJECT_LABELS").String()
-	jobLabel        = kingpin.Flag("job-label", "Label to associate pod job with other objects").Default("job").Envar("JOB_LABEL").String()
-	kubeconfig      = kingpin.Flag("kubeconfig", "Path to kubeconfig when running outside Kubernetes cluster").Default("").Envar("KUBECONFIG").String()
-	listenAddress   = kingpin.Flag("listen-address", "Address to listen for HTTP requests").Default(":8080").Envar("LISTEN_ADDRESS").String()
-	processMetrics  = kingpin.Flag("process-metrics", "Collect metrics about running process such as CPU and memory and Go stats").Default("true").Envar("PROCESS_METRICS").Bool()
-	logLevel        = kingpin.Flag("log-level", "Log level, One of: [debug, info, warn, error]").Default("info").Envar("LOG_LEVEL").Enum(promslog.LevelFlagOptions...)
-	logFormat       = kingpin.Flag("log-format", "Log format, One of: [logfmt, json]").Default("logfmt").Envar("LOG_FORMAT").Enum(promslog.FormatFlagOptions...)
-	timeNow         = time.Now
-	start           = timeNow()
-	metricBuildInfo = prometheus.NewGauge(prometheus.GaugeOpts{
+	runOnce                 = kingpin.Flag("run-once", "Set application to run once then exit, ie executed with cron").Default("false").Envar("RUN_ONCE").Bool()
+	reapMax                 = kingpin.Flag("reap-max", "Maximum objects to reap in each run, most overdue jobs are reaped first, set to 0 to disable this limit").Default("30").Envar("REAP_MAX").Int()
+	runTimeout              = kingpin.Flag("run-timeout", "Maximum duration of each run before it is aborted, set to 0 to disable").Default("0").Envar("RUN_TIMEOUT").Duration()
+	requestTimeout          = kingpin.Flag("request-timeout", "Maximum duration of each Kubernetes API request, set to 0 to disable").Default("30s").Envar("REQUEST_TIMEOUT").Duration()
+	deleteRetries           = kingpin.Flag("delete-retries", "Number of times to retry deletions that fail with throttling, server errors or timeouts").Default("3").Envar("DELETE_RETRIES").Int()
+	retryBackoff            = kingpin.Flag("retry-backoff", "Initial duration to wait before retrying a deletion, doubled for each retry unless the API server sets Retry-After").Default("1s").Envar("RETRY_BACKOFF").Duration()
+	shutdownTimeout         = kingpin.Flag("shutdown-timeout", "Time to wait for deletions in progress and the HTTP server to finish when shutting down").Default("30s").Envar("SHUTDOWN_TIMEOUT").Duration()
+	reapWorkers             = kingpin.Flag("reap-workers", "Number of namespaces to reap objects from in parallel, objects in each namespace are reaped in order").Default("1").Envar("REAP_WORKERS").Int()
+	namespaceReapMax        = kingpin.Flag("namespace-reap-max", "Comma separated list of namespace=max objects to reap in each run, use all=max to set a default for all namespaces").Default("").Envar("NAMESPACE_REAP_MAX").String()
+	typeReapMax             = kingpin.Flag("type-reap-max", "Comma separated list of type=max objects to reap in each run, types are pod, service, configmap and secret").Default("").Envar("TYPE_REAP_MAX").String()
+	reapInterval            = kingpin.Flag("reap-interval", "Duration between repear runs").Default("60s").Envar("REAP_INTERLVAL").Duration()
+	reapNamespaces          = kingpin.Flag("reap-namespaces", "Namespaces to reap, ignored if --namespace-labels is set").Default("all").Envar("REAP_NAMESPACES").String()
+	namespaceLabels         = kingpin.Flag("namespace-labels", "Labels to use when filtering namespaces, causes --namespace-labels to be ignored").Default("").Envar("NAMESPACE_LABELS").String()
+	lifetimeBasis           = kingpin.Flag("lifetime-basis", "Time pod lifetime is measured from, One of: [creation, start, running]").Default("creation").Envar("LIFETIME_BASIS").Enum(lifetimeBases...)
+	defaultLifetime         = kingpin.Flag("default-lifetime", "Lifetime of pods lacking reaper annotations, set to 0 to disable").Default("0").Envar("DEFAULT_LIFETIME").Duration()
+	maxLifetime             = kingpin.Flag("max-lifetime", "Maximum pod lifetime, longer lifetimes are clamped to this value, set to 0 to disable this limit").Default("0").Envar("MAX_LIFETIME").Duration()
+	maxExtendedLifetime     = kingpin.Flag("max-extended-lifetime", "Maximum total pod lifetime after extensions, set to 0 to use --max-lifetime").Default("0").Envar("MAX_EXTENDED_LIFETIME").Duration()
+	warningWindow           = kingpin.Flag("warning-window", "Duration before expiry to emit a Warning Event on pods, set to 0 to disable").Default("0").Envar("WARNING_WINDOW").Duration()
+	warningAnnotation       = kingpin.Flag("warning-annotation", "Annotate pods within the warning window with the time until expiry").Default("false").Envar("WARNING_ANNOTATION").Bool()
+	ttlAfterFinished        = kingpin.Flag("ttl-after-finished", "Duration after Succeeded or Failed pods finish before they are reaped, set to 0 to disable").Default("0").Envar("TTL_AFTER_FINISHED").Duration()
+	pendingTimeout          = kingpin.Flag("pending-timeout", "Duration pods can be Pending before they are reaped, set to 0 to disable").Default("0").Envar("PENDING_TIMEOUT").Duration()
+	evictedGracePeriod      = kingpin.Flag("evicted-grace-period", "Duration after pods are Evicted before they are reaped, set to 0 to disable").Default("0").Envar("EVICTED_GRACE_PERIOD").Duration()
+	oomKilledGracePeriod    = kingpin.Flag("oomkilled-grace-period", "Duration after Failed pods have a container terminated as OOMKilled before they are reaped, set to 0 to disable").Default("0").Envar("OOMKILLED_GRACE_PERIOD").Duration()
+	restartLimit            = kingpin.Flag("restart-limit", "Reap pods whose containers restart more than this many times within --restart-window, set to 0 to disable").Default("0").Envar("RESTART_LIMIT").Int()
+	restartWindow           = kingpin.Flag("restart-window", "Window of time container restarts are counted in, set to 0 to count all restarts").Default("0").Envar("RESTART_WINDOW").Duration()
+	crashLoopTimeout        = kingpin.Flag("crashloop-timeout", "Duration pods can be in CrashLoopBackOff before they are reaped, set to 0 to disable").Default("0").Envar("CRASHLOOP_TIMEOUT").Duration()
+	reapJobPods             = kingpin.Flag("reap-job-pods", "Reap all pods with the same job label when any pod of the job is reaped").Default("false").Envar("REAP_JOB_PODS").Bool()
+	objectLabels            = kingpin.Flag("object-labels", "Labels to use when filtering objects").Default("").Envar("OBJECT_LABELS").String()
+	jobLabel                = kingpin.Flag("job-label", "Label to associate pod job with other objects").Default("job").Envar("JOB_LABEL").String()
+	policyFile              = kingpin.Flag("policy-file", "Path to YAML or JSON reaping policy file").Default("").Envar("POLICY_FILE").String()
+	pageSize                = kingpin.Flag("page-size", "Maximum objects returned by each list request, set to 0 to disable pagination").Default("500").Envar("PAGE_SIZE").Int64()
+	leaderElect             = kingpin.Flag("leader-elect", "Use a Lease to elect a leader so only one replica reaps").Default("false").Envar("LEADER_ELECT").Bool()
+	leaderElectionNamespace = kingpin.Flag("leader-election-namespace", "Namespace of the leader election Lease, defaults to the namespace of the service account").Default("").Envar("LEADER_ELECTION_NAMESPACE").String()
+	leaderElectionID        = kingpin.Flag("leader-election-id", "Name of the leader election Lease").Default(appName).Envar("LEADER_ELECTION_ID").String()
+	watchMode               = kingpin.Flag("watch", "Cache objects with informers and reap pods at their expiry, --reap-interval sets the interval of full resync runs").Default("false").Envar("WATCH").Bool()
+	watchMinInterval        = kingpin.Flag("watch-min-interval", "Minimum duration between runs started by pod changes in watch mode").Default("10s").Envar("WATCH_MIN_INTERVAL").Duration()
+	configFile              = kingpin.Flag("config-file", "Path to YAML file of flag values that is reloaded on SIGHUP or when changed").Default("").Envar("CONFIG_FILE").String()
+	kubeconfig              = kingpin.Flag("kubeconfig", "Path to kubeconfig when running outside Kubernetes cluster").Default("").Envar("KUBECONFIG").String()
+	listenAddress           = kingpin.Flag("listen-address", "Address to listen for HTTP requests").Default(":8080").Envar("LISTEN_ADDRESS").String()
+	processMetrics          = kingpin.Flag("process-metrics", "Collect metrics about running process such as CPU and memory and Go stats").Default("true").Envar("PROCESS_METRICS").Bool()
+	logLevel                = kingpin.Flag("log-level", "Log level, One of: [debug, info, warn, error]").Default("info").Envar("LOG_LEVEL").Enum(promslog.LevelFlagOptions...)
+	logFormat               = kingpin.Flag("log-format", "Log format, One of: [logfmt, json]").Default("logfmt").Envar("LOG_FORMAT").Enum(promslog.FormatFlagOptions...)
+	lifetimeBases           = []string{"creation", "start", "running"}
+	clampedPods             = make(map[string]time.Time)
+	warnedPods              = make(map[string]time.Time)
+	podHistories            = make(map[string]*podHistory)
+	relatedObjectTypes      = []string{"service", "configmap", "secret"}
+	reapTypes               = append([]string{"pod"}, relatedObjectTypes...)
+	reapingPolicy           *reapPolicy
+	staticFlags             = []string{"help", "version", "run-once", "config-file", "kubeconfig", "listen-address", "process-metrics", "log-level", "log-format"}
+	flagDefaults            map[string]string
+	configChecksum          string
+	objectCache             *informerCache
+	nextExpiry              time.Time
+	errLeadershipLost       = errors.New("leadership lost")
+	lifetimeUnitsRegexp     = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([wd])`)
+	iso8601DurationRegexp   = regexp.MustCompile(`^P(?:([0-9]+(?:\.[0-9]+)?)W)?(?:([0-9]+(?:\.[0-9]+)?)D)?(?:T(?:([0-9]+(?:\.[0-9]+)?)H)?(?:([0-9]+(?:\.[0-9]+)?)M)?(?:([0-9]+(?:\.[0-9]+)?)S)?)?$`)
+	timeNow                 = time.Now
+	start                   = timeNow()
+	metricBuildInfo         = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: metricsNamespace,
 		Name:      "build_info",
 		Help:      "Build information",
@@ -75,7 +169,7 @@ var (
 			Name:      "reaped_total",
 			Help:      "Total number of object types reaped",
 		},
-		[]string{"type"},
+		[]string{"type", "reason"},
 	)
 	metricError = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: metricsNamespace,
@@ -87,6 +181,69 @@ var (
 		Name:      "errors_total",
 		Help:      "Total number of errors",
 	})
+	metricAnnotationErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "annotation_errors_total",
+			Help:      "Total number of pod annotations that could not be parsed",
+		},
+		[]string{"namespace", "annotation"},
+	)
+	metricExtensionsRefusedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "extensions_refused_total",
+			Help:      "Total number of lifetime extensions refused for exceeding the maximum extended lifetime",
+		},
+		[]string{"namespace"},
+	)
+	metricClampedTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "lifetimes_clamped_total",
+			Help:      "Total number of pods whose lifetime was clamped to the maximum lifetime",
+		},
+		[]string{"namespace"},
+	)
+	metricBacklog = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "backlog",
+			Help:      "Number of objects eligible for reaping deferred to a later run by a reap budget",
+		},
+		[]string{"namespace", "type"},
+	)
+	metricConfigReloadsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "config_reloads_total",
+			Help:      "Total number of configuration reloads",
+		},
+		[]string{"result"},
+	)
+	metricConfigLastReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Indicates the last configuration reload was successful",
+	})
+	metricLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader",
+		Help:      "Indicates this replica is the leader and is reaping",
+	})
+	metricRunsAbortedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "runs_aborted_total",
+		Help:      "Total number of runs aborted after exceeding the run timeout",
+	})
+	metricDeleteRetriesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "delete_retries_total",
+			Help:      "Total number of deletions retried after transient errors",
+		},
+		[]string{"type"},
+	)
 	metricDuration = prometheus.NewGauge(prometheus.GaugeOpts{
 		Namespace: metricsNamespace,
 		Name:      "run_duration_seconds",
@@ -95,9 +252,66 @@ var (
 )
 
 type podJob struct {
-	jobID     string
-	podName   string
-	namespace string
+	jobID          string
+	podName        string
+	podUID         types.UID
+	namespace      string
+	reason         string
+	expires        time.Time
+	relatedObjects []string
+}
+
+type reapPolicy struct {
+	Rules []policyRule `json:"rules"`
+}
+
+type policyRule struct {
+	Name             string   `json:"name"`
+	Namespaces       []string `json:"namespaces,omitempty"`
+	PodSelector      string   `json:"podSelector,omitempty"`
+	Lifetime         string   `json:"lifetime,omitempty"`
+	DefaultLifetime  string   `json:"defaultLifetime,omitempty"`
+	MaxLifetime      string   `json:"maxLifetime,omitempty"`
+	TTLAfterFinished string   `json:"ttlAfterFinished,omitempty"`
+	PendingTimeout   string   `json:"pendingTimeout,omitempty"`
+	RelatedObjects   []string `json:"relatedObjects,omitempty"`
+
+	selector  labels.Selector
+	durations map[string]time.Duration
+}
+
+type podPolicy struct {
+	rule             string
+	lifetime         time.Duration
+	defaultLifetime  time.Duration
+	maxLifetime      time.Duration
+	ttlAfterFinished time.Duration
+	pendingTimeout   time.Duration
+	relatedObjects   []string
+	ruleDurations    map[string]time.Duration
+}
+
+type podHistory struct {
+	restarts          []restartObservation
+	crashLoopSince    time.Time
+	crashLoopRestarts int32
+	lastRestartSeen   time.Time
+	lastSeen          time.Time
+}
+
+type restartObservation struct {
+	time     time.Time
+	restarts int32
+}
+
+type informerCache struct {
+	factories         map[string]informers.SharedInformerFactory
+	metadataFactories map[string]metadatainformer.SharedInformerFactory
+	namespaces        corelisters.NamespaceLister
+	wake              chan struct{}
+	filterLock        sync.Mutex
+	jobLabel          string
+	selectors         []labels.Selector
 }
 
 type jobObject struct {
@@ -105,14 +319,18 @@ type jobObject struct {
 	jobID      string
 	name       string
 	namespace  string
+	uid        types.UID
+	reason     string
 }
 
 func init() {
 	metricBuildInfo.Set(1)
-	metricReapedTotal.WithLabelValues("pod")
-	metricReapedTotal.WithLabelValues("service")
-	metricReapedTotal.WithLabelValues("configmap")
-	metricReapedTotal.WithLabelValues("secret")
+	metricReapedTotal.WithLabelValues("pod", reasonLifetime)
+	metricReapedTotal.WithLabelValues("service", reasonLifetime)
+	metricReapedTotal.WithLabelValues("configmap", reasonLifetime)
+	metricReapedTotal.WithLabelValues("secret", reasonLifetime)
+	metricConfigReloadsTotal.WithLabelValues("success")
+	metricConfigReloadsTotal.WithLabelValues("failure")
 }
 
 func main() {
@@ -120,6 +338,8 @@ func main() {
 	kingpin.HelpFlag.Short('h')
 	kingpin.Parse()
 
+	flagDefaults = getFlagValues()
+
 	level := &promslog.AllowedLevel{}
 	_ = level.Set(*logLevel)
 	format := &promslog.AllowedFormat{}
@@ -133,6 +353,13 @@ func main() {
 	var config *rest.Config
 	var err error
 
+	if err = reloadConfig(logger); err != nil {
+		os.Exit(1)
+	}
+	configChecksum = getConfigChecksum()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
 	if *kubeconfig == "" {
 		logger.Info("Loading in cluster kubeconfig", "kubeconfig", *kubeconfig)
 		config, err = rest.InClusterConfig()
@@ -150,6 +377,11 @@ func main() {
 		logger.Error("Unable to generate Clientset", "err", err)
 		os.Exit(1)
 	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		logger.Error("Unable to generate metadata client", "err", err)
+		os.Exit(1)
+	}
 
 	logger.Info(fmt.Sprintf("Starting %s", appName), "version", version.Info())
 	logger.Info("Build context", "build_context", version.BuildContext())
@@ -165,17 +397,99 @@ func main() {
 	})
 	http.Handle(metricsPath, promhttp.HandlerFor(metricGathers(), promhttp.HandlerOpts{}))
 
+	server := &http.Server{Addr: *listenAddress}
 	go func() {
-		if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("Error starting HTTP server", "err", err)
 			os.Exit(1)
 		}
 	}()
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if *leaderElect && !*runOnce {
+		err = runLeaderElection(ctx, clientset, metadataClient, hup, logger)
+		if err != nil {
+			logger.Error("Error running leader election", "err", err)
+		}
+	} else {
+		metricLeader.Set(1)
+		err = reapLoop(ctx, clientset, metadataClient, hup, logger)
+		if ctx.Err() != nil {
+			logFinalRun(err, logger)
+			err = nil
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	logger.Info("Stopping HTTP server")
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error stopping HTTP server", "err", err)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// reapLoop reaps every --reap-interval until the context is cancelled.
+// With --run-once it returns the error of the single run.
+// Once the context is cancelled it returns the error of the run in progress, if any.
+func reapLoop(ctx context.Context, clientset kubernetes.Interface, metadataClient metadata.Interface, hup chan os.Signal, logger *slog.Logger) error {
+	var cache *informerCache
+	if *watchMode && !*runOnce {
+		namespaces, err := getNamespaces(ctx, clientset, logger)
+		if err != nil {
+			return err
+		}
+		logger.Info("Starting informers", "namespaces", strings.Join(namespaces, ","))
+		cache, err = newInformerCache(clientset, metadataClient, namespaces, ctx.Done(), logger)
+		if err != nil {
+			logger.Error("Error starting informers", "err", err)
+			return err
+		}
+		defer func() { objectCache = nil }()
+	}
+	var nextResync time.Time
+	reload := false
 	for {
 		var errNum int
+		if !reload {
+			select {
+			case <-hup:
+				reload = true
+			default:
+			}
+		}
+		if reload {
+			logger.Info("Received SIGHUP, reloading configuration")
+			configChecksum = getConfigChecksum()
+			_ = reloadConfig(logger)
+			reload = false
+		} else if checksum := getConfigChecksum(); checksum != configChecksum {
+			logger.Info("Configuration changed, reloading configuration")
+			configChecksum = checksum
+			_ = reloadConfig(logger)
+		}
+		if cache != nil {
+			cache.setPodFilter(*jobLabel, *objectLabels)
+		}
 		start = timeNow()
-		err = run(clientset, logger)
+		runStart := time.Now()
+		if cache != nil && !start.Before(nextResync) {
+			logger.Debug("Running full resync")
+			objectCache = nil
+			nextResync = start.Add(*reapInterval)
+		} else {
+			objectCache = cache
+		}
+		runCtx, cancel := runContext(ctx)
+		err := run(runCtx, clientset, metadataClient, logger)
+		if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			logger.Error("Run aborted after exceeding run timeout", "timeout", *runTimeout)
+			metricRunsAbortedTotal.Inc()
+		}
+		cancel()
 		metricDuration.Set(time.Since(start).Seconds())
 		if err != nil {
 			errNum = 1
@@ -183,37 +497,165 @@ func main() {
 			errNum = 0
 		}
 		metricError.Set(float64(errNum))
+		if ctx.Err() != nil {
+			return err
+		}
 		if *runOnce {
-			os.Exit(errNum)
+			return err
+		}
+		wait := *reapInterval
+		var wake chan struct{}
+		if cache != nil {
+			wait = time.Until(nextResync)
+			if !nextExpiry.IsZero() && nextExpiry.Sub(timeNow()) < wait {
+				wait = nextExpiry.Sub(timeNow()) + time.Second
+			}
+			wake = cache.wake
+			logger.Debug("Waiting for next expiry or pod change", "wait", wait.Round(time.Second))
 		} else {
 			logger.Debug("Sleeping for interval", "interval", fmt.Sprintf("%.0f", (*reapInterval).Seconds()))
-			time.Sleep(*reapInterval)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		case <-wake:
+			logger.Debug("Pods changed")
+			if delay := *watchMinInterval - time.Since(runStart); delay > 0 {
+				logger.Debug("Delaying run started by pod changes", "delay", delay.Round(time.Millisecond))
+				timer.Stop()
+				timer = time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil
+				case <-timer.C:
+				case <-hup:
+					reload = true
+				}
+			}
+		case <-hup:
+			reload = true
+		}
+		timer.Stop()
+	}
+}
+
+// logFinalRun logs whether the run in progress when shutting down completed.
+func logFinalRun(err error, logger *slog.Logger) {
+	if errors.Is(err, context.Canceled) {
+		logger.Warn("Shutting down, final run interrupted")
+	} else {
+		logger.Info("Shutting down, final run completed")
+	}
+}
+
+// runLeaderElection reaps only while holding the --leader-election-id Lease, until the context is cancelled.
+func runLeaderElection(ctx context.Context, clientset kubernetes.Interface, metadataClient metadata.Interface, hup chan os.Signal, logger *slog.Logger) error {
+	namespace := *leaderElectionNamespace
+	if namespace == "" {
+		data, err := os.ReadFile(serviceAccountNamespaceFile)
+		if err != nil {
+			return fmt.Errorf("unable to determine leader election namespace, set --leader-election-namespace: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	leaderLogger := logger.With("lease", *leaderElectionID, "namespace", namespace, "identity", identity)
+	var reaping sync.Mutex
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta:  metav1.ObjectMeta{Name: *leaderElectionID, Namespace: namespace},
+			Client:     clientset.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+		},
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		ReleaseOnCancel: true,
+		Name:            *leaderElectionID,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				reaping.Lock()
+				defer reaping.Unlock()
+				leaderLogger.Info("Became leader, starting reaping")
+				metricLeader.Set(1)
+				reapCtx, cancel := context.WithCancelCause(ctx)
+				defer cancel(nil)
+				stopLeading := context.AfterFunc(leaderCtx, func() {
+					if ctx.Err() == nil {
+						cancel(errLeadershipLost)
+					}
+				})
+				defer stopLeading()
+				err := reapLoop(reapCtx, clientset, metadataClient, hup, leaderLogger)
+				if ctx.Err() != nil {
+					logFinalRun(err, leaderLogger)
+				} else if err != nil {
+					leaderLogger.Error("Error reaping as leader", "err", err)
+				}
+			},
+			OnStoppedLeading: func() {
+				leaderLogger.Info("Stopped leading, stopping reaping")
+				metricLeader.Set(0)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					leaderLogger.Info("Another replica is leader", "leader", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	metricLeader.Set(0)
+	for {
+		elector.Run(ctx)
+		if ctx.Err() != nil {
+			reaping.Lock()
+			defer reaping.Unlock()
+			return nil
 		}
 	}
 }
 
-func run(clientset kubernetes.Interface, logger *slog.Logger) error {
-	namespaces, err := getNamespaces(clientset, logger)
+func run(ctx context.Context, clientset kubernetes.Interface, metadataClient metadata.Interface, logger *slog.Logger) error {
+	namespaces, err := getNamespaces(ctx, clientset, logger)
 	if err != nil {
 		logger.Error("Error getting namespaces", "err", err)
 		return err
 	}
-	jobs, jobIDs, err := getJobs(clientset, namespaces, logger)
+	jobs, jobIDs, nsAnnotations, err := getJobs(ctx, clientset, namespaces, logger)
 	if err != nil {
 		logger.Error("Error getting jods", "err", err)
 		return err
 	}
-	orphanedObjects, err := getOrphanedJobObjects(clientset, jobs, jobIDs, namespaces, logger)
+	orphanedObjects, err := getOrphanedJobObjects(ctx, metadataClient, jobs, jobIDs, namespaces, logger)
 	if err != nil {
 		logger.Error("Error getting orphaned objects", "err", err)
 	}
-	jobObjects, err := getJobObjects(clientset, jobs, logger)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].expires.Before(jobs[j].expires)
+	})
+	jobObjects, err := getJobObjects(ctx, clientset, metadataClient, jobs, logger)
 	if err != nil {
 		logger.Error("Error getting job objects", "err", err)
 		return err
 	}
 	jobObjects = append(jobObjects, orphanedObjects...)
-	errCount := reap(clientset, jobObjects, logger)
+	jobObjects = limitJobObjects(jobObjects, nsAnnotations, logger)
+	errCount, skipped := reap(ctx, clientset, jobObjects, logger)
+	if skipped > 0 {
+		err := fmt.Errorf("run interrupted with %d objects not reaped: %w", skipped, ctx.Err())
+		logger.Error(err.Error())
+		return err
+	}
 	if errCount > 0 {
 		err := fmt.Errorf("%d errors encountered during reap", errCount)
 		logger.Error(err.Error())
@@ -222,7 +664,7 @@ func run(clientset kubernetes.Interface, logger *slog.Logger) error {
 	return nil
 }
 
-func getNamespaces(clientset kubernetes.Interface, logger *slog.Logger) ([]string, error) {
+func getNamespaces(ctx context.Context, clientset kubernetes.Interface, logger *slog.Logger) ([]string, error) {
 	var namespaces []string
 	namespaces = strings.Split(*reapNamespaces, ",")
 	if len(namespaces) == 1 && strings.ToLower(namespaces[0]) == "all" {
@@ -236,13 +678,13 @@ func getNamespaces(clientset kubernetes.Interface, logger *slog.Logger) ([]strin
 				LabelSelector: label,
 			}
 			logger.Debug("Getting namespaces with label", "label", label)
-			ns, err := clientset.CoreV1().Namespaces().List(context.TODO(), nsListOptions)
+			ns, err := listNamespaces(ctx, clientset, nsListOptions, logger)
 			if err != nil {
 				logger.Error("Error getting namespace list", "label", label, "err", err)
 				return nil, err
 			}
-			logger.Debug("Namespaces returned", "count", len(ns.Items))
-			for _, namespace := range ns.Items {
+			logger.Debug("Namespaces returned", "count", len(ns))
+			for _, namespace := range ns {
 				namespaces = append(namespaces, namespace.Name)
 			}
 		}
@@ -251,23 +693,28 @@ func getNamespaces(clientset kubernetes.Interface, logger *slog.Logger) ([]strin
 	return namespaces, nil
 }
 
-func getJobs(clientset kubernetes.Interface, namespaces []string, logger *slog.Logger) ([]podJob, []string, error) {
+func getJobs(ctx context.Context, clientset kubernetes.Interface, namespaces []string, logger *slog.Logger) ([]podJob, []string, map[string]map[string]string, error) {
 	labels := strings.Split(*objectLabels, ",")
 	jobs := []podJob{}
 	jobIDs := []string{}
-	toReap := 0
+	nsAnnotations, err := getNamespaceAnnotations(ctx, clientset, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	runStart := timeNow()
+	nextExpiry = time.Time{}
 	for _, ns := range namespaces {
 		for _, l := range labels {
 			listOptions := metav1.ListOptions{
 				LabelSelector: l,
 			}
-			pods, err := clientset.CoreV1().Pods(ns).List(context.TODO(), listOptions)
+			pods, err := listPods(ctx, clientset, ns, listOptions, logger)
 			if err != nil {
 				logger.Error("Error getting pod list", "label", l, "namespace", ns, "err", err)
 				metricErrorsTotal.Inc()
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
-			for _, pod := range pods.Items {
+			for _, pod := range pods {
 				podLogger := logger.With("pod", pod.Name, "namespace", pod.Namespace)
 				var jobID string
 				if val, ok := pod.Labels[*jobLabel]; ok {
@@ -283,228 +730,1590 @@ func getJobs(clientset kubernetes.Interface, namespaces []string, logger *slog.L
 				if !sliceContains(jobIDs, jobID) {
 					jobIDs = append(jobIDs, jobID)
 				}
-				if *reapMax != 0 && toReap >= *reapMax {
-					logger.Info("Max reap reached, skipping rest", "max", *reapMax)
+				if pod.DeletionTimestamp != nil {
+					podLogger.Debug("Pod is being deleted, skipping")
 					continue
 				}
-				var lifetime time.Duration
-				if val, ok := pod.Annotations[lifetimeAnnotation]; !ok {
-					podLogger.Debug("Pod lacks reaper annotation, skipping", "annotation", lifetimeAnnotation)
+				policy := getPodPolicy(pod)
+				if policy.rule != "" {
+					podLogger = podLogger.With("rule", policy.rule)
+				}
+				expires, reason, ok := getPodReapTime(ctx, clientset, pod, nsAnnotations[pod.Namespace], policy, podLogger)
+				if !ok {
 					continue
-				} else {
-					podLogger.Debug("Found pod with reaper annotation", "annotation", val)
-					lifetime, err = time.ParseDuration(val)
-					if err != nil {
-						podLogger.Error("Error parsing annotation, SKIPPING", "annotation", val, "err", err)
-						metricErrorsTotal.Inc()
-						continue
-					}
 				}
 				currentLifetime := timeNow().Sub(pod.CreationTimestamp.Time)
-				podLogger.Debug("Pod lifetime", "lifetime", currentLifetime.Seconds())
-				if currentLifetime > lifetime {
-					podLogger.Debug("Pod is past its lifetime and will be killed.")
-					job := podJob{jobID: jobID, podName: pod.Name, namespace: pod.Namespace}
+				podLogger.Debug("Pod lifetime", "lifetime", currentLifetime.Seconds(), "expires", expires, "reason", reason)
+				next := expires
+				if *warningWindow != 0 && timeNow().Before(expires.Add(-*warningWindow)) {
+					next = expires.Add(-*warningWindow)
+				}
+				if timeNow().Before(next) && (nextExpiry.IsZero() || next.Before(nextExpiry)) {
+					nextExpiry = next
+				}
+				if timeNow().After(expires) {
+					podLogger.Debug("Pod is past its lifetime and will be killed.", "reason", reason)
+					job := podJob{jobID: jobID, podName: pod.Name, podUID: pod.UID, namespace: pod.Namespace, reason: reason, expires: expires, relatedObjects: policy.relatedObjects}
 					jobs = append(jobs, job)
+				} else if *warningWindow != 0 && timeNow().After(expires.Add(-*warningWindow)) {
+					warnPod(ctx, clientset, pod, expires, podLogger)
 				}
 			}
 		}
 	}
-	return jobs, jobIDs, nil
+	for key, lastSeen := range clampedPods {
+		if lastSeen.Before(runStart) {
+			delete(clampedPods, key)
+		}
+	}
+	for key, lastSeen := range warnedPods {
+		if lastSeen.Before(runStart) {
+			delete(warnedPods, key)
+		}
+	}
+	for key, history := range podHistories {
+		if history.lastSeen.Before(runStart) {
+			delete(podHistories, key)
+		}
+	}
+	return jobs, jobIDs, nsAnnotations, nil
 }
 
-func getOrphanedJobObjects(clientset kubernetes.Interface, jobs []podJob, jobIDs []string, namespaces []string, logger *slog.Logger) ([]jobObject, error) {
-	logger.Debug("JobIDs to evaluate being orphaned", "jobIDs", strings.Join(jobIDs, ","))
-	jobObjects := []jobObject{}
-	labels := strings.Split(*objectLabels, ",")
-	for _, namespace := range namespaces {
-		orphanedLogger := logger.With("namespace", namespace)
-		for _, l := range labels {
-			listOptions := metav1.ListOptions{
-				LabelSelector: l,
-			}
-			services, err := clientset.CoreV1().Services(namespace).List(context.TODO(), listOptions)
-			if err != nil {
-				orphanedLogger.Error("Error getting services", "err", err)
-				metricErrorsTotal.Inc()
-				return nil, err
-			}
-			for _, service := range services.Items {
-				if start.Before(service.CreationTimestamp.Time) {
-					continue
-				}
-				if val, ok := service.Labels[*jobLabel]; ok {
-					orphanedLogger.Debug("Service has job label", "job", val)
-					if !sliceContains(jobIDs, val) {
-						orphanedLogger.Debug("Found orphaned Service", "job", val, "name", service.Name, "namespace", service.Namespace)
-						jobObject := jobObject{objectType: "service", jobID: val, name: service.Name, namespace: service.Namespace}
-						jobObjects = append(jobObjects, jobObject)
-					} else {
-						orphanedLogger.Debug("Service is not orphaned", "job", val, "name", service.Name, "namespace", service.Namespace)
-					}
-				} else {
-					orphanedLogger.Debug("Service lacks job label", "name", service.Name, "namespace", service.Namespace)
-				}
-			}
-			configmaps, err := clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), listOptions)
-			if err != nil {
-				orphanedLogger.Error("Error getting config maps", "err", err)
-				metricErrorsTotal.Inc()
-				return nil, err
-			}
-			for _, configmap := range configmaps.Items {
-				if start.Before(configmap.CreationTimestamp.Time) {
-					continue
-				}
-				if val, ok := configmap.Labels[*jobLabel]; ok {
-					orphanedLogger.Debug("ConfigMap has job label", "job", val)
-					if !sliceContains(jobIDs, val) {
-						orphanedLogger.Debug("Found orphaned ConfigMap", "job", val, "name", configmap.Name, "namespace", configmap.Namespace)
-						jobObject := jobObject{objectType: "configmap", jobID: val, name: configmap.Name, namespace: configmap.Namespace}
-						jobObjects = append(jobObjects, jobObject)
-					} else {
-						orphanedLogger.Debug("ConfigMap is not orphaned", "job", val, "name", configmap.Name, "namespace", configmap.Namespace)
-					}
-				} else {
-					orphanedLogger.Debug("ConfigMap lacks job label", "name", configmap.Name, "namespace", configmap.Namespace)
-				}
-			}
-			secrets, err := clientset.CoreV1().Secrets(namespace).List(context.TODO(), listOptions)
-			if err != nil {
-				orphanedLogger.Error("Error getting secrets", "err", err)
-				metricErrorsTotal.Inc()
-				return nil, err
+// getPodReapTime returns the earliest time a pod is eligible for reaping across all reaping policies, along with the reason.
+func getPodReapTime(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod, nsAnnotations map[string]string, policy podPolicy, logger *slog.Logger) (time.Time, string, bool) {
+	reason := reasonLifetime
+	expires, ok := getPodExpiry(ctx, clientset, pod, nsAnnotations, policy, logger)
+	if finishedExpires, finished := getFinishedExpiry(pod, policy, logger); finished && (!ok || finishedExpires.Before(expires)) {
+		expires = finishedExpires
+		reason = reasonFinished
+		ok = true
+	}
+	if pendingExpires, pendingReason, pending := getPendingExpiry(pod, policy, logger); pending && (!ok || pendingExpires.Before(expires)) {
+		expires = pendingExpires
+		reason = pendingReason
+		ok = true
+	}
+	if terminatedExpires, terminatedReason, terminated := getTerminatedExpiry(pod, logger); terminated && (!ok || terminatedExpires.Before(expires)) {
+		expires = terminatedExpires
+		reason = terminatedReason
+		ok = true
+	}
+	if restartExpires, restarted := getRestartExpiry(pod, logger); restarted && (!ok || restartExpires.Before(expires)) {
+		expires = restartExpires
+		reason = reasonRestarts
+		ok = true
+	}
+	if crashLoopExpires, crashLooping := getCrashLoopExpiry(pod, logger); crashLooping && (!ok || crashLoopExpires.Before(expires)) {
+		expires = crashLoopExpires
+		reason = reasonCrashLoop
+		ok = true
+	}
+	return expires, reason, ok
+}
+
+// getTerminatedExpiry returns the time an Evicted or OOMKilled pod expires based on --evicted-grace-period or --oomkilled-grace-period.
+// Only Failed pods are eligible so pods with other containers still running are left alone.
+func getTerminatedExpiry(pod v1.Pod, logger *slog.Logger) (time.Time, string, bool) {
+	if *evictedGracePeriod != 0 && pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted" {
+		evicted := getFinishedTime(pod)
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.DisruptionTarget && condition.Status == v1.ConditionTrue {
+				evicted = condition.LastTransitionTime.Time
 			}
-			for _, secret := range secrets.Items {
-				if start.Before(secret.CreationTimestamp.Time) {
-					continue
-				}
-				if val, ok := secret.Labels[*jobLabel]; ok {
-					orphanedLogger.Debug("Secret has job label", "job", val)
-					if !sliceContains(jobIDs, val) {
-						orphanedLogger.Debug("Found orphaned Secret", "job", val, "name", secret.Name, "namespace", secret.Namespace)
-						jobObject := jobObject{objectType: "secret", jobID: val, name: secret.Name, namespace: secret.Namespace}
-						jobObjects = append(jobObjects, jobObject)
-					} else {
-						orphanedLogger.Debug("Secret is not orphaned", "job", val, "name", secret.Name, "namespace", secret.Namespace)
-					}
-				} else {
-					orphanedLogger.Debug("Secret lacks job label", "name", secret.Name, "namespace", secret.Namespace)
-				}
+		}
+		logger.Debug("Pod was evicted", "evicted", evicted, "message", pod.Status.Message)
+		return evicted.Add(*evictedGracePeriod), reasonEvicted, true
+	}
+	if *oomKilledGracePeriod != 0 && pod.Status.Phase == v1.PodFailed {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil && status.State.Terminated.Reason == "OOMKilled" {
+				logger.Debug("Pod container was OOMKilled", "container", status.Name, "finished", status.State.Terminated.FinishedAt)
+				return status.State.Terminated.FinishedAt.Add(*oomKilledGracePeriod), reasonOOMKilled, true
 			}
 		}
 	}
-	return jobObjects, nil
+	return time.Time{}, "", false
 }
 
-func getJobObjects(clientset kubernetes.Interface, jobs []podJob, logger *slog.Logger) ([]jobObject, error) {
-	jobObjects := []jobObject{}
-	for _, job := range jobs {
-		jobObjects = append(jobObjects, jobObject{objectType: "pod", jobID: job.jobID, name: job.podName, namespace: job.namespace})
-		jobLogger := logger.With("job", job.jobID, "namespace", job.namespace)
-		if job.jobID == "none" {
-			jobLogger.Debug("Job ID is none, skipping search for additional objects")
-			continue
+// getRestartExpiry returns the time a pod whose containers restarted more than --restart-limit times within --restart-window became eligible for reaping.
+// Restarts within the window are counted from the restart counts observed on previous runs.
+func getRestartExpiry(pod v1.Pod, logger *slog.Logger) (time.Time, bool) {
+	if *restartLimit == 0 {
+		return time.Time{}, false
+	}
+	var restarts int32
+	var lastRestart time.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+		if status.LastTerminationState.Terminated != nil && status.LastTerminationState.Terminated.FinishedAt.After(lastRestart) {
+			lastRestart = status.LastTerminationState.Terminated.FinishedAt.Time
 		}
-		listOptions := metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("%s=%s", *jobLabel, job.jobID),
+	}
+	if *restartWindow != 0 {
+		history := getPodHistory(pod)
+		windowStart := timeNow().Add(-*restartWindow)
+		history.restarts = append(history.restarts, restartObservation{time: timeNow(), restarts: restarts})
+		for len(history.restarts) > 1 && !history.restarts[1].time.After(windowStart) {
+			history.restarts = history.restarts[1:]
 		}
-		services, err := clientset.CoreV1().Services(job.namespace).List(context.TODO(), listOptions)
-		if err != nil {
-			jobLogger.Error("Error getting services", "err", err)
-			metricErrorsTotal.Inc()
-			return nil, err
+		started := pod.Status.StartTime != nil && pod.Status.StartTime.After(windowStart)
+		if !started || !history.restarts[0].time.After(windowStart) {
+			restarts -= history.restarts[0].restarts
 		}
-		for _, service := range services.Items {
-			jobObject := jobObject{objectType: "service", jobID: job.jobID, name: service.Name, namespace: service.Namespace}
-			jobObjects = append(jobObjects, jobObject)
+	}
+	logger.Debug("Pod restarts", "restarts", restarts, "limit", *restartLimit, "window", *restartWindow)
+	if restarts <= int32(*restartLimit) {
+		return time.Time{}, false
+	}
+	if lastRestart.IsZero() {
+		lastRestart = pod.CreationTimestamp.Time
+	}
+	return lastRestart, true
+}
+
+// getCrashLoopExpiry returns the time a pod in CrashLoopBackOff expires based on --crashloop-timeout.
+// Time in CrashLoopBackOff is measured from when the pod was first seen in that state.
+// Containers briefly run between back-offs, so the time is only reset once restarts stop for longer than the maximum back-off.
+func getCrashLoopExpiry(pod v1.Pod, logger *slog.Logger) (time.Time, bool) {
+	if *crashLoopTimeout == 0 {
+		return time.Time{}, false
+	}
+	crashLooping := false
+	var restarts int32
+	for _, status := range pod.Status.ContainerStatuses {
+		restarts += status.RestartCount
+		if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+			crashLooping = true
 		}
-		configmaps, err := clientset.CoreV1().ConfigMaps(job.namespace).List(context.TODO(), listOptions)
-		if err != nil {
-			jobLogger.Error("Error getting config maps", "err", err)
-			metricErrorsTotal.Inc()
-			return nil, err
+	}
+	history := getPodHistory(pod)
+	if restarts > history.crashLoopRestarts {
+		history.crashLoopRestarts = restarts
+		history.lastRestartSeen = timeNow()
+	}
+	if !crashLooping && !history.crashLoopSince.IsZero() && timeNow().Sub(history.lastRestartSeen) > crashLoopResetAfter {
+		logger.Debug("Pod restarts stopped, no longer in CrashLoopBackOff", "since", history.crashLoopSince)
+		history.crashLoopSince = time.Time{}
+	}
+	if history.crashLoopSince.IsZero() {
+		if !crashLooping {
+			return time.Time{}, false
 		}
-		for _, configmap := range configmaps.Items {
-			jobObject := jobObject{objectType: "configmap", jobID: job.jobID, name: configmap.Name, namespace: configmap.Namespace}
-			jobObjects = append(jobObjects, jobObject)
+		history.crashLoopSince = timeNow()
+	}
+	logger.Debug("Pod is in CrashLoopBackOff", "since", history.crashLoopSince)
+	return history.crashLoopSince.Add(*crashLoopTimeout), true
+}
+
+// getPodHistory returns the state tracked for a pod across runs.
+func getPodHistory(pod v1.Pod) *podHistory {
+	key := podKey(pod)
+	history, ok := podHistories[key]
+	if !ok {
+		history = &podHistory{}
+		podHistories[key] = history
+	}
+	history.lastSeen = timeNow()
+	return history
+}
+
+func podKey(pod v1.Pod) string {
+	return fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, pod.UID)
+}
+
+// getPendingExpiry returns the time a pod stuck in the Pending phase expires based on its pending timeout.
+// Pods the scheduler has marked as Unschedulable are given their own reason.
+func getPendingExpiry(pod v1.Pod, policy podPolicy, logger *slog.Logger) (time.Time, string, bool) {
+	if policy.pendingTimeout == 0 || pod.Status.Phase != v1.PodPending {
+		return time.Time{}, "", false
+	}
+	reason := reasonPending
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason == v1.PodReasonUnschedulable {
+			reason = reasonUnschedulable
 		}
-		secrets, err := clientset.CoreV1().Secrets(job.namespace).List(context.TODO(), listOptions)
-		if err != nil {
-			jobLogger.Error("Error getting secrets", "err", err)
-			metricErrorsTotal.Inc()
-			return nil, err
+	}
+	logger.Debug("Pod is pending", "reason", reason, "message", pod.Status.Message)
+	return pod.CreationTimestamp.Time.Add(policy.pendingTimeout), reason, true
+}
+
+// warnPod emits a Warning Event on a pod that is about to expire and optionally annotates it with the time remaining.
+// Each expiry of a pod is only warned about once and the annotation is only updated when the remaining minutes change.
+func warnPod(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod, expires time.Time, logger *slog.Logger) {
+	expiresIn := expires.Sub(timeNow()).Round(time.Second)
+	key := fmt.Sprintf("%s/%d", podKey(pod), expires.Unix())
+	if _, ok := warnedPods[key]; ok {
+		logger.Debug("Pod already warned of expiry", "expires", expires)
+		warnedPods[key] = timeNow()
+	} else {
+		event := &v1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s.expires-%d", pod.Name, expires.Unix()),
+				Namespace: pod.Namespace,
+			},
+			InvolvedObject: v1.ObjectReference{
+				Kind:            "Pod",
+				APIVersion:      "v1",
+				Name:            pod.Name,
+				Namespace:       pod.Namespace,
+				UID:             pod.UID,
+				ResourceVersion: pod.ResourceVersion,
+			},
+			Reason:         "LifetimeExpiring",
+			Message:        fmt.Sprintf("Pod will be reaped in %s at %s", expiresIn, expires.UTC().Format(time.RFC3339)),
+			Type:           v1.EventTypeWarning,
+			Source:         v1.EventSource{Component: appName},
+			FirstTimestamp: metav1.NewTime(timeNow()),
+			LastTimestamp:  metav1.NewTime(timeNow()),
+			Count:          1,
 		}
-		for _, secret := range secrets.Items {
-			jobObject := jobObject{objectType: "secret", jobID: job.jobID, name: secret.Name, namespace: secret.Namespace}
-			jobObjects = append(jobObjects, jobObject)
+		requestCtx, cancel := requestContext(ctx)
+		defer cancel()
+		_, err := clientset.CoreV1().Events(pod.Namespace).Create(requestCtx, event, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			logger.Debug("Pod already warned of expiry", "expires", expires)
+			warnedPods[key] = timeNow()
+		} else if err != nil {
+			logger.Error("Error creating pod expiry event", "err", err)
+			metricErrorsTotal.Inc()
+		} else {
+			logger.Info("Pod warned of expiry", "expires", expires)
+			warnedPods[key] = timeNow()
 		}
 	}
-	return jobObjects, nil
+	expiresInMinutes := expiresIn.Round(time.Minute).String()
+	if !*warningAnnotation || pod.Annotations[expiresInAnnotation] == expiresInMinutes {
+		return
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				expiresInAnnotation: expiresInMinutes,
+			},
+		},
+	})
+	requestCtx, cancel := requestContext(ctx)
+	defer cancel()
+	_, err := clientset.CoreV1().Pods(pod.Namespace).Patch(requestCtx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		logger.Error("Error annotating pod expiry", "err", err)
+		metricErrorsTotal.Inc()
+	}
 }
 
-func reap(clientset kubernetes.Interface, jobObjects []jobObject, logger *slog.Logger) int {
-	deletedPods := 0
-	deletedServices := 0
-	deletedConfigMaps := 0
-	deletedSecrets := 0
-	errCount := 0
-	for _, job := range jobObjects {
-		reapLogger := logger.With("job", job.jobID, "name", job.name, "namespace", job.namespace)
-		switch job.objectType {
-		case "pod":
-			err := clientset.CoreV1().Pods(job.namespace).Delete(context.TODO(), job.name, metav1.DeleteOptions{})
-			if err != nil {
-				errCount++
-				reapLogger.Error("Error deleting pod", "err", err)
-				metricErrorsTotal.Inc()
-				continue
-			}
-			reapLogger.Info("Pod deleted")
-			metricReapedTotal.With(prometheus.Labels{"type": "pod"}).Inc()
-			deletedPods++
-		case "service":
-			err := clientset.CoreV1().Services(job.namespace).Delete(context.TODO(), job.name, metav1.DeleteOptions{})
+// getPodExpiry returns the time a pod expires based on its lifetime and expires-at annotations.
+// When both annotations are present the earliest expiry wins.
+// Pods lacking both annotations or with an unparseable annotation are not eligible for reaping.
+func getPodExpiry(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod, nsAnnotations map[string]string, policy podPolicy, logger *slog.Logger) (time.Time, bool) {
+	var expires time.Time
+	var lifetime time.Duration
+	var err error
+	found := false
+	hasLifetime := false
+	if policy.lifetime != 0 {
+		logger.Debug("Using policy lifetime", "lifetime", policy.lifetime)
+		lifetime = policy.lifetime
+		hasLifetime = true
+	} else if val, ok := pod.Annotations[lifetimeAnnotation]; ok {
+		logger.Debug("Found pod with reaper annotation", "annotation", val)
+		lifetime, err = parseLifetime(val)
+		if err != nil {
+			logAnnotationError(pod, lifetimeAnnotation, err, logger)
+			return expires, false
+		}
+		hasLifetime = true
+	} else if _, ok := pod.Annotations[expiresAtAnnotation]; !ok {
+		lifetime, hasLifetime = getDefaultLifetime(nsAnnotations, policy, logger)
+	}
+	ceiling := getPolicyDuration(policy, "maxLifetime", nsAnnotations, maxLifetimeAnnotation, policy.maxLifetime, logger)
+	if hasLifetime {
+		lifetime = clampLifetime(pod, lifetime, ceiling, logger)
+		lifetime, err = extendLifetime(ctx, clientset, pod, lifetime, ceiling, nsAnnotations, logger)
+		if err != nil {
+			logAnnotationError(pod, extendByAnnotation, err, logger)
+			return expires, false
+		}
+		lifetimeStart, started, err := getLifetimeStart(pod)
+		if err != nil {
+			logAnnotationError(pod, basisAnnotation, err, logger)
+			return expires, false
+		}
+		if started {
+			expires = lifetimeStart.Add(lifetime)
+			found = true
+		} else {
+			logger.Debug("Pod lifetime has not started yet")
+		}
+	}
+	if val, ok := pod.Annotations[expiresAtAnnotation]; ok {
+		logger.Debug("Found pod with expires-at annotation", "annotation", val)
+		expiresAt, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			logAnnotationError(pod, expiresAtAnnotation, err, logger)
+			return expires, false
+		}
+		if requested := expiresAt.Sub(pod.CreationTimestamp.Time); clampLifetime(pod, requested, ceiling, logger) != requested {
+			expiresAt = pod.CreationTimestamp.Time.Add(ceiling)
+		}
+		if !found || expiresAt.Before(expires) {
+			expires = expiresAt
+		}
+		found = true
+	}
+	if !found {
+		logger.Debug("Pod has no expiry, skipping", "annotations", strings.Join([]string{lifetimeAnnotation, expiresAtAnnotation}, ","))
+	}
+	return expires, found
+}
+
+// getFinishedExpiry returns the time a Succeeded or Failed pod expires based on its time-to-live after finishing.
+// A rule's time-to-live takes precedence over the pod's ttl-after-finished annotation, which takes precedence over --ttl-after-finished.
+func getFinishedExpiry(pod v1.Pod, policy podPolicy, logger *slog.Logger) (time.Time, bool) {
+	if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+		return time.Time{}, false
+	}
+	ttl := policy.ttlAfterFinished
+	_, ruleTTL := policy.ruleDurations["ttlAfterFinished"]
+	if val, ok := pod.Annotations[ttlAfterFinishedAnnotation]; ok && !ruleTTL {
+		var err error
+		ttl, err = parseLifetime(val)
+		if err != nil {
+			logAnnotationError(pod, ttlAfterFinishedAnnotation, err, logger)
+			return time.Time{}, false
+		}
+	} else if ttl == 0 {
+		return time.Time{}, false
+	}
+	finished := getFinishedTime(pod)
+	logger.Debug("Pod has finished", "phase", pod.Status.Phase, "finished", finished, "ttl", ttl)
+	return finished.Add(ttl), true
+}
+
+// getFinishedTime returns when the last container of a pod terminated.
+// Pods without terminated containers fall back to their start or creation time.
+func getFinishedTime(pod v1.Pod) time.Time {
+	var finished time.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated != nil && status.State.Terminated.FinishedAt.After(finished) {
+			finished = status.State.Terminated.FinishedAt.Time
+		}
+	}
+	if !finished.IsZero() {
+		return finished
+	}
+	if pod.Status.StartTime != nil {
+		return pod.Status.StartTime.Time
+	}
+	return pod.CreationTimestamp.Time
+}
+
+// getDefaultLifetime returns the lifetime for pods lacking their own reaper annotations.
+// A rule's default lifetime takes precedence over the namespace's default-lifetime annotation, which takes precedence over --default-lifetime.
+func getDefaultLifetime(nsAnnotations map[string]string, policy podPolicy, logger *slog.Logger) (time.Duration, bool) {
+	defaultLifetime := getPolicyDuration(policy, "defaultLifetime", nsAnnotations, defaultLifetimeAnnotation, policy.defaultLifetime, logger)
+	if defaultLifetime == 0 {
+		return 0, false
+	}
+	logger.Debug("Pod lacks reaper annotation, using default lifetime", "lifetime", defaultLifetime)
+	return defaultLifetime, true
+}
+
+// clampLifetime limits a pod's requested lifetime to the maximum lifetime.
+// Clamped pods are logged and counted the first time they are seen.
+func clampLifetime(pod v1.Pod, lifetime time.Duration, ceiling time.Duration, logger *slog.Logger) time.Duration {
+	if ceiling == 0 || lifetime <= ceiling {
+		return lifetime
+	}
+	key := podKey(pod)
+	if _, ok := clampedPods[key]; !ok {
+		logger.Info("Pod lifetime exceeds maximum lifetime, clamping", "lifetime", lifetime, "max", ceiling)
+		metricClampedTotal.With(prometheus.Labels{"namespace": pod.Namespace}).Inc()
+	} else {
+		logger.Debug("Pod lifetime exceeds maximum lifetime, clamping", "lifetime", lifetime, "max", ceiling)
+	}
+	clampedPods[key] = timeNow()
+	return ceiling
+}
+
+// extendLifetime adds the extensions requested by a pod's extend-by annotation to its lifetime.
+// Extensions that would take the total lifetime beyond the maximum extended lifetime are refused.
+// The maximum lifetime ceiling limits extensions when no maximum extended lifetime is set.
+func extendLifetime(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod, lifetime time.Duration, ceiling time.Duration, nsAnnotations map[string]string, logger *slog.Logger) (time.Duration, error) {
+	val, ok := pod.Annotations[extendByAnnotation]
+	if !ok {
+		return lifetime, nil
+	}
+	maxLifetime := getNamespaceDuration(nsAnnotations, maxExtendedLifetimeAnnotation, *maxExtendedLifetime, logger)
+	if maxLifetime == 0 {
+		maxLifetime = ceiling
+	}
+	applied := 0
+	refused := 0
+	for _, e := range strings.Split(val, ",") {
+		extension, err := parseLifetime(e)
+		if err != nil {
+			return lifetime, err
+		}
+		if maxLifetime != 0 && lifetime+extension > maxLifetime {
+			logger.Debug("Lifetime extension exceeds maximum extended lifetime", "extension", extension, "lifetime", lifetime, "max", maxLifetime)
+			refused++
+			continue
+		}
+		lifetime += extension
+		applied++
+	}
+	logger.Debug("Pod lifetime extended", "extensions", applied, "refused", refused, "lifetime", lifetime)
+	recordExtensions(ctx, clientset, pod, applied, refused, logger)
+	return lifetime, nil
+}
+
+// recordExtensions annotates a pod with the number of applied and refused extensions.
+// Refused extensions are only logged and counted the first time they are seen.
+func recordExtensions(ctx context.Context, clientset kubernetes.Interface, pod v1.Pod, applied int, refused int, logger *slog.Logger) {
+	prevApplied, _ := strconv.Atoi(pod.Annotations[extensionsAnnotation])
+	prevRefused, _ := strconv.Atoi(pod.Annotations[extensionsRefusedAnnotation])
+	if applied == prevApplied && refused == prevRefused {
+		return
+	}
+	if refused > prevRefused {
+		logger.Info("Refused lifetime extension beyond maximum extended lifetime", "refused", refused-prevRefused)
+		metricExtensionsRefusedTotal.With(prometheus.Labels{"namespace": pod.Namespace}).Add(float64(refused - prevRefused))
+	}
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				extensionsAnnotation:        strconv.Itoa(applied),
+				extensionsRefusedAnnotation: strconv.Itoa(refused),
+			},
+		},
+	})
+	requestCtx, cancel := requestContext(ctx)
+	defer cancel()
+	_, err := clientset.CoreV1().Pods(pod.Namespace).Patch(requestCtx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		logger.Error("Error recording pod extensions", "err", err)
+		metricErrorsTotal.Inc()
+	}
+}
+
+// getLifetimeStart returns the time a pod's lifetime is measured from.
+// The basis comes from --lifetime-basis unless overridden by the pod's lifetime-basis annotation.
+// Pods that have not yet reached the basis, such as pods still Pending, return false.
+// There is no basis counting only time in the Running phase, pods never return to Pending so "running" covers that while a pod runs.
+func getLifetimeStart(pod v1.Pod) (time.Time, bool, error) {
+	basis := *lifetimeBasis
+	if val, ok := pod.Annotations[basisAnnotation]; ok {
+		if !sliceContains(lifetimeBases, val) {
+			return time.Time{}, false, fmt.Errorf("invalid lifetime basis %q", val)
+		}
+		basis = val
+	}
+	switch basis {
+	case "start":
+		if pod.Status.StartTime == nil {
+			return time.Time{}, false, nil
+		}
+		return pod.Status.StartTime.Time, true, nil
+	case "running":
+		var running time.Time
+		for _, status := range pod.Status.ContainerStatuses {
+			var startedAt time.Time
+			if status.State.Running != nil {
+				startedAt = status.State.Running.StartedAt.Time
+			} else if status.State.Terminated != nil {
+				startedAt = status.State.Terminated.StartedAt.Time
+			} else if status.LastTerminationState.Terminated != nil {
+				startedAt = status.LastTerminationState.Terminated.StartedAt.Time
+			}
+			if startedAt.IsZero() {
+				continue
+			}
+			if running.IsZero() || startedAt.Before(running) {
+				running = startedAt
+			}
+		}
+		return running, !running.IsZero(), nil
+	default:
+		return pod.CreationTimestamp.Time, true, nil
+	}
+}
+
+func getNamespaceAnnotations(ctx context.Context, clientset kubernetes.Interface, logger *slog.Logger) (map[string]map[string]string, error) {
+	nsAnnotations := make(map[string]map[string]string)
+	namespaces, err := listNamespaces(ctx, clientset, metav1.ListOptions{}, logger)
+	if err != nil {
+		logger.Error("Error getting namespace list", "err", err)
+		metricErrorsTotal.Inc()
+		return nil, err
+	}
+	for _, namespace := range namespaces {
+		nsAnnotations[namespace.Name] = namespace.Annotations
+	}
+	return nsAnnotations, nil
+}
+
+// logAnnotationError logs and counts a pod annotation that could not be parsed.
+func logAnnotationError(pod v1.Pod, annotation string, err error, logger *slog.Logger) {
+	logger.Error("Error parsing annotation, SKIPPING", "annotation", pod.Annotations[annotation], "err", err)
+	metricErrorsTotal.Inc()
+	metricAnnotationErrorsTotal.With(prometheus.Labels{"namespace": pod.Namespace, "annotation": annotation}).Inc()
+}
+
+// parseLifetime parses a lifetime duration.
+// In addition to Go durations, day and week units such as 7d or 1w2d12h and ISO 8601 durations such as P1DT12H are accepted.
+func parseLifetime(val string) (time.Duration, error) {
+	val = strings.TrimSpace(val)
+	if strings.HasPrefix(val, "P") {
+		return parseISO8601Duration(val)
+	}
+	var lifetime time.Duration
+	rest := val
+	for {
+		match := lifetimeUnitsRegexp.FindStringSubmatch(rest)
+		if match == nil {
+			break
+		}
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", val)
+		}
+		unit := 24 * time.Hour
+		if match[2] == "w" {
+			unit = 7 * 24 * time.Hour
+		}
+		var ok bool
+		if lifetime, ok = addDuration(lifetime, value, unit); !ok {
+			return 0, fmt.Errorf("invalid duration %q", val)
+		}
+		rest = rest[len(match[0]):]
+	}
+	if rest == "" {
+		if lifetime == 0 && val == "" {
+			return 0, fmt.Errorf("invalid duration %q", val)
+		}
+		return lifetime, nil
+	}
+	duration, err := time.ParseDuration(rest)
+	if err != nil || (duration > 0 && lifetime > math.MaxInt64-duration) {
+		return 0, fmt.Errorf("invalid duration %q", val)
+	}
+	return lifetime + duration, nil
+}
+
+// parseISO8601Duration parses an ISO 8601 duration such as P1W, P1DT12H or PT30M.
+// Years and months are rejected as they have no fixed length.
+func parseISO8601Duration(val string) (time.Duration, error) {
+	match := iso8601DurationRegexp.FindStringSubmatch(val)
+	if match == nil || val == "P" || strings.HasSuffix(val, "T") {
+		return 0, fmt.Errorf("invalid ISO 8601 duration %q", val)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var duration time.Duration
+	for i, unit := range units {
+		if match[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", val)
+		}
+		var ok bool
+		if duration, ok = addDuration(duration, value, unit); !ok {
+			return 0, fmt.Errorf("invalid ISO 8601 duration %q", val)
+		}
+	}
+	return duration, nil
+}
+
+// addDuration adds value units to duration, returning false if the result overflows a time.Duration.
+func addDuration(duration time.Duration, value float64, unit time.Duration) (time.Duration, bool) {
+	add := value * float64(unit)
+	if add >= float64(math.MaxInt64-duration) {
+		return 0, false
+	}
+	return duration + time.Duration(add), true
+}
+
+// getPolicyDuration returns a setting of the rule matching a pod if the rule sets it.
+// Otherwise the namespace annotation is used, falling back to defaultValue.
+func getPolicyDuration(policy podPolicy, setting string, nsAnnotations map[string]string, annotation string, defaultValue time.Duration, logger *slog.Logger) time.Duration {
+	if val, ok := policy.ruleDurations[setting]; ok {
+		return val
+	}
+	return getNamespaceDuration(nsAnnotations, annotation, defaultValue, logger)
+}
+
+// getNamespaceDuration returns the duration from a namespace annotation, or defaultValue if the annotation is absent or invalid.
+func getNamespaceDuration(nsAnnotations map[string]string, annotation string, defaultValue time.Duration, logger *slog.Logger) time.Duration {
+	val, ok := nsAnnotations[annotation]
+	if !ok {
+		return defaultValue
+	}
+	duration, err := parseLifetime(val)
+	if err != nil {
+		logger.Error("Error parsing namespace annotation, using default", "annotation", val, "err", err)
+		metricErrorsTotal.Inc()
+		return defaultValue
+	}
+	return duration
+}
+
+func getOrphanedJobObjects(ctx context.Context, metadataClient metadata.Interface, jobs []podJob, jobIDs []string, namespaces []string, logger *slog.Logger) ([]jobObject, error) {
+	logger.Debug("JobIDs to evaluate being orphaned", "jobIDs", strings.Join(jobIDs, ","))
+	jobObjects := []jobObject{}
+	labels := strings.Split(*objectLabels, ",")
+	for _, namespace := range namespaces {
+		orphanedLogger := logger.With("namespace", namespace)
+		for _, l := range labels {
+			listOptions := metav1.ListOptions{
+				LabelSelector: l,
+			}
+			services, err := listObjectMetadata(ctx, metadataClient, "service", namespace, listOptions, orphanedLogger)
 			if err != nil {
-				errCount++
-				reapLogger.Error("Error deleting service", "err", err)
+				orphanedLogger.Error("Error getting services", "err", err)
 				metricErrorsTotal.Inc()
-				continue
+				return nil, err
+			}
+			for _, service := range services {
+				if start.Before(service.CreationTimestamp.Time) {
+					continue
+				}
+				if val, ok := service.Labels[*jobLabel]; ok {
+					orphanedLogger.Debug("Service has job label", "job", val)
+					if !sliceContains(jobIDs, val) {
+						orphanedLogger.Debug("Found orphaned Service", "job", val, "name", service.Name, "namespace", service.Namespace)
+						jobObject := jobObject{objectType: "service", jobID: val, name: service.Name, namespace: service.Namespace, uid: service.UID, reason: reasonOrphaned}
+						jobObjects = append(jobObjects, jobObject)
+					} else {
+						orphanedLogger.Debug("Service is not orphaned", "job", val, "name", service.Name, "namespace", service.Namespace)
+					}
+				} else {
+					orphanedLogger.Debug("Service lacks job label", "name", service.Name, "namespace", service.Namespace)
+				}
 			}
-			reapLogger.Info("Service deleted")
-			metricReapedTotal.With(prometheus.Labels{"type": "service"}).Inc()
-			deletedServices++
-		case "configmap":
-			err := clientset.CoreV1().ConfigMaps(job.namespace).Delete(context.TODO(), job.name, metav1.DeleteOptions{})
+			configmaps, err := listObjectMetadata(ctx, metadataClient, "configmap", namespace, listOptions, orphanedLogger)
 			if err != nil {
-				errCount++
-				reapLogger.Error("Error deleting config map", "err", err)
+				orphanedLogger.Error("Error getting config maps", "err", err)
 				metricErrorsTotal.Inc()
-				continue
+				return nil, err
 			}
-			reapLogger.Info("ConfigMap deleted")
-			metricReapedTotal.With(prometheus.Labels{"type": "configmap"}).Inc()
-			deletedConfigMaps++
-		case "secret":
-			err := clientset.CoreV1().Secrets(job.namespace).Delete(context.TODO(), job.name, metav1.DeleteOptions{})
+			for _, configmap := range configmaps {
+				if start.Before(configmap.CreationTimestamp.Time) {
+					continue
+				}
+				if val, ok := configmap.Labels[*jobLabel]; ok {
+					orphanedLogger.Debug("ConfigMap has job label", "job", val)
+					if !sliceContains(jobIDs, val) {
+						orphanedLogger.Debug("Found orphaned ConfigMap", "job", val, "name", configmap.Name, "namespace", configmap.Namespace)
+						jobObject := jobObject{objectType: "configmap", jobID: val, name: configmap.Name, namespace: configmap.Namespace, uid: configmap.UID, reason: reasonOrphaned}
+						jobObjects = append(jobObjects, jobObject)
+					} else {
+						orphanedLogger.Debug("ConfigMap is not orphaned", "job", val, "name", configmap.Name, "namespace", configmap.Namespace)
+					}
+				} else {
+					orphanedLogger.Debug("ConfigMap lacks job label", "name", configmap.Name, "namespace", configmap.Namespace)
+				}
+			}
+			secrets, err := listObjectMetadata(ctx, metadataClient, "secret", namespace, listOptions, orphanedLogger)
 			if err != nil {
-				errCount++
-				reapLogger.Error("Error deleting secret", "err", err)
+				orphanedLogger.Error("Error getting secrets", "err", err)
 				metricErrorsTotal.Inc()
-				continue
+				return nil, err
 			}
-			reapLogger.Info("Secret deleted")
-			metricReapedTotal.With(prometheus.Labels{"type": "secret"}).Inc()
-			deletedSecrets++
+			for _, secret := range secrets {
+				if start.Before(secret.CreationTimestamp.Time) {
+					continue
+				}
+				if val, ok := secret.Labels[*jobLabel]; ok {
+					orphanedLogger.Debug("Secret has job label", "job", val)
+					if !sliceContains(jobIDs, val) {
+						orphanedLogger.Debug("Found orphaned Secret", "job", val, "name", secret.Name, "namespace", secret.Namespace)
+						jobObject := jobObject{objectType: "secret", jobID: val, name: secret.Name, namespace: secret.Namespace, uid: secret.UID, reason: reasonOrphaned}
+						jobObjects = append(jobObjects, jobObject)
+					} else {
+						orphanedLogger.Debug("Secret is not orphaned", "job", val, "name", secret.Name, "namespace", secret.Namespace)
+					}
+				} else {
+					orphanedLogger.Debug("Secret lacks job label", "name", secret.Name, "namespace", secret.Namespace)
+				}
+			}
+		}
+	}
+	return jobObjects, nil
+}
+
+func getJobObjects(ctx context.Context, clientset kubernetes.Interface, metadataClient metadata.Interface, jobs []podJob, logger *slog.Logger) ([]jobObject, error) {
+	jobObjects := []jobObject{}
+	jobPods := make(map[string]bool)
+	seenJobs := make(map[string]bool)
+	for _, job := range jobs {
+		if jobPods[job.namespace+"/"+job.podName] {
+			continue
+		}
+		jobPods[job.namespace+"/"+job.podName] = true
+		jobObjects = append(jobObjects, jobObject{objectType: "pod", jobID: job.jobID, name: job.podName, namespace: job.namespace, uid: job.podUID, reason: job.reason})
+		jobLogger := logger.With("job", job.jobID, "namespace", job.namespace)
+		if job.jobID == "none" {
+			jobLogger.Debug("Job ID is none, skipping search for additional objects")
+			continue
+		}
+		if seenJobs[job.namespace+"/"+job.jobID] {
+			jobLogger.Debug("Job already searched for additional objects")
+			continue
+		}
+		seenJobs[job.namespace+"/"+job.jobID] = true
+		listOptions := metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", *jobLabel, job.jobID),
+		}
+		if *reapJobPods {
+			pods, err := listPods(ctx, clientset, job.namespace, listOptions, jobLogger)
+			if err != nil {
+				jobLogger.Error("Error getting pods", "err", err)
+				metricErrorsTotal.Inc()
+				return nil, err
+			}
+			for _, pod := range pods {
+				if jobPods[pod.Namespace+"/"+pod.Name] {
+					continue
+				}
+				jobLogger.Debug("Found sibling pod of expired pod", "name", pod.Name, "pod", job.podName)
+				jobPods[pod.Namespace+"/"+pod.Name] = true
+				jobObject := jobObject{objectType: "pod", jobID: job.jobID, name: pod.Name, namespace: pod.Namespace, uid: pod.UID, reason: job.reason}
+				jobObjects = append(jobObjects, jobObject)
+			}
+		}
+		if job.relatedObjects == nil || sliceContains(job.relatedObjects, "service") {
+			services, err := listObjectMetadata(ctx, metadataClient, "service", job.namespace, listOptions, jobLogger)
+			if err != nil {
+				jobLogger.Error("Error getting services", "err", err)
+				metricErrorsTotal.Inc()
+				return nil, err
+			}
+			for _, service := range services {
+				jobObject := jobObject{objectType: "service", jobID: job.jobID, name: service.Name, namespace: service.Namespace, uid: service.UID, reason: job.reason}
+				jobObjects = append(jobObjects, jobObject)
+			}
+		}
+		if job.relatedObjects == nil || sliceContains(job.relatedObjects, "configmap") {
+			configmaps, err := listObjectMetadata(ctx, metadataClient, "configmap", job.namespace, listOptions, jobLogger)
+			if err != nil {
+				jobLogger.Error("Error getting config maps", "err", err)
+				metricErrorsTotal.Inc()
+				return nil, err
+			}
+			for _, configmap := range configmaps {
+				jobObject := jobObject{objectType: "configmap", jobID: job.jobID, name: configmap.Name, namespace: configmap.Namespace, uid: configmap.UID, reason: job.reason}
+				jobObjects = append(jobObjects, jobObject)
+			}
+		}
+		if job.relatedObjects == nil || sliceContains(job.relatedObjects, "secret") {
+			secrets, err := listObjectMetadata(ctx, metadataClient, "secret", job.namespace, listOptions, jobLogger)
+			if err != nil {
+				jobLogger.Error("Error getting secrets", "err", err)
+				metricErrorsTotal.Inc()
+				return nil, err
+			}
+			for _, secret := range secrets {
+				jobObject := jobObject{objectType: "secret", jobID: job.jobID, name: secret.Name, namespace: secret.Namespace, uid: secret.UID, reason: job.reason}
+				jobObjects = append(jobObjects, jobObject)
+			}
+		}
+	}
+	return jobObjects, nil
+}
+
+// limitJobObjects limits the objects reaped in a run to --reap-max and to the namespace and object type budgets.
+// Objects are expected to be ordered with the most overdue jobs first, so those jobs are reaped first.
+// The objects of a job are reaped or deferred together, so the last job reaped can take a budget over its limit.
+// Objects over a budget are deferred to a later run and counted in the backlog metric.
+func limitJobObjects(jobObjects []jobObject, nsAnnotations map[string]map[string]string, logger *slog.Logger) []jobObject {
+	metricBacklog.Reset()
+	if len(jobObjects) == 0 {
+		return jobObjects
+	}
+	namespaceBudgets, _ := parseBudgets(*namespaceReapMax, nil)
+	typeBudgets, _ := parseBudgets(*typeReapMax, reapTypes)
+	groups := [][]jobObject{}
+	groupIndexes := make(map[string]int)
+	for _, job := range jobObjects {
+		key := job.namespace + "/" + job.jobID
+		if job.jobID == "none" {
+			key += "/" + job.objectType + "/" + job.name
+		}
+		index, ok := groupIndexes[key]
+		if !ok {
+			index = len(groups)
+			groupIndexes[key] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], job)
+	}
+	budgets := make(map[string]int)
+	limitedObjects := []jobObject{}
+	namespaceCounts := make(map[string]int)
+	typeCounts := make(map[string]int)
+	deferred := 0
+	for _, group := range groups {
+		namespace := group[0].namespace
+		namespaceBudget, ok := budgets[namespace]
+		if !ok {
+			namespaceBudget = getNamespaceBudget(namespaceBudgets, nsAnnotations[namespace], namespace, logger)
+			budgets[namespace] = namespaceBudget
+		}
+		overBudget := (*reapMax != 0 && len(limitedObjects) >= *reapMax) ||
+			(namespaceBudget != 0 && namespaceCounts[namespace] >= namespaceBudget)
+		for _, job := range group {
+			if typeBudget := typeBudgets[job.objectType]; typeBudget != 0 && typeCounts[job.objectType] >= typeBudget {
+				overBudget = true
+			}
+		}
+		if overBudget {
+			for _, job := range group {
+				logger.Debug("Reap budget reached, deferring to next run", "type", job.objectType, "name", job.name, "namespace", job.namespace, "job", job.jobID)
+				metricBacklog.With(prometheus.Labels{"namespace": job.namespace, "type": job.objectType}).Inc()
+				deferred++
+			}
+			continue
+		}
+		limitedObjects = append(limitedObjects, group...)
+		namespaceCounts[namespace] += len(group)
+		for _, job := range group {
+			typeCounts[job.objectType]++
+		}
+	}
+	if deferred > 0 {
+		logger.Info("Reap budget reached, deferring rest to next run", "max", *reapMax, "deferred", deferred)
+	}
+	return limitedObjects
+}
+
+// getNamespaceBudget returns the reap budget for a namespace.
+// The namespace's reap-max annotation takes precedence over --namespace-reap-max.
+func getNamespaceBudget(namespaceBudgets map[string]int, nsAnnotations map[string]string, namespace string, logger *slog.Logger) int {
+	if val, ok := nsAnnotations[reapMaxAnnotation]; ok {
+		budget, err := strconv.Atoi(val)
+		if err == nil && budget >= 0 {
+			return budget
+		}
+		logger.Error("Error parsing namespace annotation, using default", "annotation", val, "namespace", namespace, "err", err)
+		metricErrorsTotal.Inc()
+	}
+	if budget, ok := namespaceBudgets[namespace]; ok {
+		return budget
+	}
+	return namespaceBudgets["all"]
+}
+
+// parseBudgets parses a comma separated list of name=max reap budgets.
+// If names is not nil each name must be one of names.
+func parseBudgets(val string, names []string) (map[string]int, error) {
+	budgets := make(map[string]int)
+	if val == "" {
+		return budgets, nil
+	}
+	for _, budget := range strings.Split(val, ",") {
+		name, value, found := strings.Cut(budget, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid budget %q, expected name=max", budget)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid budget %q, max must be a non-negative integer", budget)
+		}
+		name = strings.TrimSpace(name)
+		if names != nil && !sliceContains(names, name) {
+			return nil, fmt.Errorf("invalid budget %q, name must be one of: %s", budget, strings.Join(names, ", "))
+		}
+		budgets[name] = limit
+	}
+	return budgets, nil
+}
+
+// reap deletes job objects, returning the number of errors and of objects skipped because the context was cancelled.
+// Deletions in progress when the context is cancelled are given --shutdown-timeout to finish,
+// unless leadership was lost in which case they are cancelled so they do not overlap with the new leader.
+func reap(ctx context.Context, clientset kubernetes.Interface, jobObjects []jobObject, logger *slog.Logger) (int, int) {
+	namespaces := []string{}
+	namespaceObjects := make(map[string][]jobObject)
+	for _, job := range jobObjects {
+		if _, ok := namespaceObjects[job.namespace]; !ok {
+			namespaces = append(namespaces, job.namespace)
 		}
+		namespaceObjects[job.namespace] = append(namespaceObjects[job.namespace], job)
 	}
+	workers := *reapWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	deleteCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+	timeout := *shutdownTimeout
+	stopShutdownTimeout := context.AfterFunc(ctx, func() {
+		if errors.Is(context.Cause(ctx), errLeadershipLost) {
+			logger.Info("Leadership lost, cancelling deletions in progress")
+			cancel()
+			return
+		}
+		logger.Info("Run cancelled, waiting for deletions in progress", "timeout", timeout)
+		time.AfterFunc(timeout, cancel)
+	})
+	defer stopShutdownTimeout()
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	deleted := make(map[string]int)
+	errCount := 0
+	skipped := 0
+	queue := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for namespace := range queue {
+				objects := namespaceObjects[namespace]
+				sort.SliceStable(objects, func(i, j int) bool {
+					return objects[i].objectType == "pod" && objects[j].objectType != "pod"
+				})
+				for _, job := range objects {
+					if ctx.Err() != nil {
+						lock.Lock()
+						skipped++
+						lock.Unlock()
+						continue
+					}
+					err := deleteObject(deleteCtx, clientset, job, logger)
+					lock.Lock()
+					if err != nil {
+						errCount++
+					} else {
+						deleted[job.objectType]++
+					}
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, namespace := range namespaces {
+		queue <- namespace
+	}
+	close(queue)
+	wg.Wait()
 	logger.Info("Reap summary",
-		"pods", deletedPods,
-		"services", deletedServices,
-		"configmaps", deletedConfigMaps,
-		"secrets", deletedSecrets,
+		"pods", deleted["pod"],
+		"services", deleted["service"],
+		"configmaps", deleted["configmap"],
+		"secrets", deleted["secret"],
+		"skipped", skipped,
 	)
-	return errCount
+	return errCount, skipped
+}
+
+// deleteObject deletes a single job object and records it in the reaped metrics.
+// Deletes are preconditioned on the UID seen when the object was listed so a recreated object with the same name is not deleted.
+// Objects that are already gone or were replaced are skipped without being counted as reaped.
+func deleteObject(ctx context.Context, clientset kubernetes.Interface, job jobObject, logger *slog.Logger) error {
+	reapLogger := logger.With("job", job.jobID, "name", job.name, "namespace", job.namespace, "reason", job.reason)
+	var kind, errMsg string
+	deleteOptions := metav1.DeleteOptions{}
+	if job.uid != "" {
+		deleteOptions.Preconditions = metav1.NewUIDPreconditions(string(job.uid))
+	}
+	var deleteFunc func(context.Context) error
+	switch job.objectType {
+	case "pod":
+		kind, errMsg = "Pod", "Error deleting pod"
+		deleteFunc = func(ctx context.Context) error {
+			return clientset.CoreV1().Pods(job.namespace).Delete(ctx, job.name, deleteOptions)
+		}
+	case "service":
+		kind, errMsg = "Service", "Error deleting service"
+		deleteFunc = func(ctx context.Context) error {
+			return clientset.CoreV1().Services(job.namespace).Delete(ctx, job.name, deleteOptions)
+		}
+	case "configmap":
+		kind, errMsg = "ConfigMap", "Error deleting config map"
+		deleteFunc = func(ctx context.Context) error {
+			return clientset.CoreV1().ConfigMaps(job.namespace).Delete(ctx, job.name, deleteOptions)
+		}
+	case "secret":
+		kind, errMsg = "Secret", "Error deleting secret"
+		deleteFunc = func(ctx context.Context) error {
+			return clientset.CoreV1().Secrets(job.namespace).Delete(ctx, job.name, deleteOptions)
+		}
+	default:
+		return nil
+	}
+	err := retryDelete(ctx, job.objectType, reapLogger, deleteFunc)
+	if apierrors.IsNotFound(err) {
+		reapLogger.Info(kind + " already deleted")
+		return nil
+	}
+	if apierrors.IsConflict(err) {
+		reapLogger.Warn(kind+" was replaced since it was listed, skipping", "uid", job.uid, "err", err)
+		return nil
+	}
+	if err != nil {
+		reapLogger.Error(errMsg, "err", err)
+		metricErrorsTotal.Inc()
+		return err
+	}
+	reapLogger.Info(kind + " deleted")
+	metricReapedTotal.With(prometheus.Labels{"type": job.objectType, "reason": job.reason}).Inc()
+	return nil
+}
+
+// retryDelete calls deleteFunc with a request context, retrying transient errors up to --delete-retries times.
+func retryDelete(ctx context.Context, objectType string, logger *slog.Logger, deleteFunc func(context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		requestCtx, cancel := requestContext(ctx)
+		err := deleteFunc(requestCtx)
+		cancel()
+		if err == nil || attempt >= *deleteRetries || ctx.Err() != nil || !isRetryable(err) {
+			return err
+		}
+		delay := retryDelay(err, attempt)
+		logger.Warn("Retrying deletion", "type", objectType, "attempt", attempt+1, "delay", delay, "err", err)
+		metricDeleteRetriesTotal.With(prometheus.Labels{"type": objectType}).Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable returns true for throttling, server errors and timeouts.
+func isRetryable(err error) bool {
+	if apierrors.IsTooManyRequests(err) || apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) {
+		return true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= http.StatusInternalServerError {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryDelay returns the Retry-After delay suggested by the API server, or --retry-backoff doubled for each attempt.
+func retryDelay(err error, attempt int) time.Duration {
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return *retryBackoff << attempt
+}
+
+// loadPolicy reads and validates a YAML or JSON policy file.
+// Unknown fields, invalid namespace patterns, selectors, durations and object types are rejected.
+func loadPolicy(file string) (*reapPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &reapPolicy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy file %s: %w", file, err)
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i)
+		}
+		for _, namespace := range rule.Namespaces {
+			if _, err := path.Match(namespace, ""); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid namespace pattern %q: %w", rule.Name, namespace, err)
+			}
+		}
+		rule.selector, err = labels.Parse(rule.PodSelector)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid pod selector %q: %w", rule.Name, rule.PodSelector, err)
+		}
+		rule.durations = make(map[string]time.Duration)
+		for name, val := range map[string]string{
+			"lifetime":         rule.Lifetime,
+			"defaultLifetime":  rule.DefaultLifetime,
+			"maxLifetime":      rule.MaxLifetime,
+			"ttlAfterFinished": rule.TTLAfterFinished,
+			"pendingTimeout":   rule.PendingTimeout,
+		} {
+			if val == "" {
+				continue
+			}
+			duration, err := parseLifetime(val)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: invalid %s: %w", rule.Name, name, err)
+			}
+			rule.durations[name] = duration
+		}
+		for _, objectType := range rule.RelatedObjects {
+			if !sliceContains(relatedObjectTypes, objectType) {
+				return nil, fmt.Errorf("rule %s: invalid related object type %q, must be one of %s", rule.Name, objectType, strings.Join(relatedObjectTypes, ", "))
+			}
+		}
+	}
+	return policy, nil
+}
+
+// getPodPolicy returns the reaping settings for a pod.
+// Settings come from flags, overridden by the first rule of the policy file that matches the pod.
+// Settings of a rule take precedence over pod and namespace annotations.
+func getPodPolicy(pod v1.Pod) podPolicy {
+	policy := podPolicy{
+		defaultLifetime:  *defaultLifetime,
+		maxLifetime:      *maxLifetime,
+		ttlAfterFinished: *ttlAfterFinished,
+		pendingTimeout:   *pendingTimeout,
+	}
+	if reapingPolicy == nil {
+		return policy
+	}
+	for _, rule := range reapingPolicy.Rules {
+		if !rule.matches(pod) {
+			continue
+		}
+		policy.rule = rule.Name
+		policy.ruleDurations = rule.durations
+		policy.lifetime = rule.durations["lifetime"]
+		if val, ok := rule.durations["defaultLifetime"]; ok {
+			policy.defaultLifetime = val
+		}
+		if val, ok := rule.durations["maxLifetime"]; ok {
+			policy.maxLifetime = val
+		}
+		if val, ok := rule.durations["ttlAfterFinished"]; ok {
+			policy.ttlAfterFinished = val
+		}
+		if val, ok := rule.durations["pendingTimeout"]; ok {
+			policy.pendingTimeout = val
+		}
+		if rule.RelatedObjects != nil {
+			policy.relatedObjects = rule.RelatedObjects
+		}
+		break
+	}
+	return policy
+}
+
+func (r policyRule) matches(pod v1.Pod) bool {
+	if len(r.Namespaces) > 0 {
+		matched := false
+		for _, namespace := range r.Namespaces {
+			if ok, _ := path.Match(namespace, pod.Namespace); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return r.selector.Matches(labels.Set(pod.Labels))
+}
+
+// newInformerCache starts informers for pods, services, config maps and secrets in the given namespaces.
+// Pod changes are sent to the wake channel so pods are evaluated without waiting for the next run.
+func newInformerCache(clientset kubernetes.Interface, metadataClient metadata.Interface, namespaces []string, stopCh <-chan struct{}, logger *slog.Logger) (*informerCache, error) {
+	cache := &informerCache{
+		factories:         make(map[string]informers.SharedInformerFactory),
+		metadataFactories: make(map[string]metadatainformer.SharedInformerFactory),
+		wake:              make(chan struct{}, 1),
+	}
+	cache.setPodFilter(*jobLabel, *objectLabels)
+	namespaceFactory := informers.NewSharedInformerFactory(clientset, 0)
+	cache.namespaces = namespaceFactory.Core().V1().Namespaces().Lister()
+	namespaceFactory.Start(stopCh)
+	for _, namespace := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+		_, err := factory.Core().V1().Pods().Informer().AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				if pod, ok := obj.(*v1.Pod); !ok || cache.reapable(pod) {
+					cache.notify()
+				}
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldPod, oldOK := oldObj.(*v1.Pod)
+				newPod, newOK := newObj.(*v1.Pod)
+				if !oldOK || !newOK || (cache.reapable(newPod) && podChanged(oldPod, newPod)) {
+					cache.notify()
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				if pod, ok := obj.(*v1.Pod); !ok || cache.reapable(pod) {
+					cache.notify()
+				}
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		metadataFactory := metadatainformer.NewFilteredSharedInformerFactory(metadataClient, 0, namespace, nil)
+		for _, objectType := range relatedObjectTypes {
+			metadataFactory.ForResource(objectResource(objectType)).Informer()
+		}
+		metadataFactory.Start(stopCh)
+		cache.metadataFactories[namespace] = metadataFactory
+		factory.Start(stopCh)
+		cache.factories[namespace] = factory
+	}
+	for informerType, synced := range namespaceFactory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return nil, fmt.Errorf("timed out waiting for %v cache to sync", informerType)
+		}
+	}
+	for namespace, factory := range cache.factories {
+		for informerType, synced := range factory.WaitForCacheSync(stopCh) {
+			if !synced {
+				return nil, fmt.Errorf("timed out waiting for %v cache to sync in namespace %q", informerType, namespace)
+			}
+		}
+	}
+	for namespace, factory := range cache.metadataFactories {
+		for resource, synced := range factory.WaitForCacheSync(stopCh) {
+			if !synced {
+				return nil, fmt.Errorf("timed out waiting for %v cache to sync in namespace %q", resource, namespace)
+			}
+		}
+	}
+	logger.Info("Informer caches synced")
+	return cache, nil
+}
+
+// setPodFilter sets the job label and object labels pods need for their changes to wake the reaper.
+func (c *informerCache) setPodFilter(jobLabel string, objectLabels string) {
+	selectors := []labels.Selector{}
+	for _, l := range strings.Split(objectLabels, ",") {
+		if selector, err := labels.Parse(l); err == nil {
+			selectors = append(selectors, selector)
+		}
+	}
+	c.filterLock.Lock()
+	defer c.filterLock.Unlock()
+	c.jobLabel = jobLabel
+	c.selectors = selectors
+}
+
+// reapable returns true if a pod has the job label and matches the object labels so it could be reaped.
+func (c *informerCache) reapable(pod *v1.Pod) bool {
+	c.filterLock.Lock()
+	defer c.filterLock.Unlock()
+	if _, ok := pod.Labels[c.jobLabel]; !ok && c.jobLabel != "none" {
+		return false
+	}
+	for _, selector := range c.selectors {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *informerCache) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// factory returns the informer factory caching a namespace, nil if the namespace is not cached.
+func (c *informerCache) factory(namespace string) informers.SharedInformerFactory {
+	if c == nil {
+		return nil
+	}
+	if factory, ok := c.factories[namespace]; ok {
+		return factory
+	}
+	return c.factories[metav1.NamespaceAll]
+}
+
+// metadataFactory returns the metadata informer factory caching a namespace, nil if the namespace is not cached.
+func (c *informerCache) metadataFactory(namespace string) metadatainformer.SharedInformerFactory {
+	if c == nil {
+		return nil
+	}
+	if factory, ok := c.metadataFactories[namespace]; ok {
+		return factory
+	}
+	return c.metadataFactories[metav1.NamespaceAll]
+}
+
+// podChanged returns true if a pod update could change when the pod is reaped.
+// Updates to only the expires-in annotation written by the reaper are ignored.
+func podChanged(oldPod *v1.Pod, newPod *v1.Pod) bool {
+	oldAnnotations := make(map[string]string)
+	for key, val := range oldPod.Annotations {
+		oldAnnotations[key] = val
+	}
+	newAnnotations := make(map[string]string)
+	for key, val := range newPod.Annotations {
+		newAnnotations[key] = val
+	}
+	delete(oldAnnotations, expiresInAnnotation)
+	delete(newAnnotations, expiresInAnnotation)
+	return !reflect.DeepEqual(oldAnnotations, newAnnotations) ||
+		!reflect.DeepEqual(oldPod.Labels, newPod.Labels) ||
+		!reflect.DeepEqual(oldPod.Status, newPod.Status)
+}
+
+// runContext returns a context for a single run limited by --run-timeout.
+func runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if *runTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, *runTimeout)
+}
+
+// requestContext returns a context for a single API request limited by --request-timeout.
+func requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if *requestTimeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, *requestTimeout)
+}
+
+// listPages calls list for each page of --page-size results until there is no continue token.
+// If the continue token expires the list is reset and fetched again without pagination.
+func listPages(ctx context.Context, listOptions metav1.ListOptions, logger *slog.Logger, list func(context.Context, metav1.ListOptions) (string, error), reset func()) error {
+	listOptions.Limit = *pageSize
+	for {
+		requestCtx, cancel := requestContext(ctx)
+		continueToken, err := list(requestCtx, listOptions)
+		cancel()
+		if apierrors.IsResourceExpired(err) && listOptions.Continue != "" {
+			logger.Warn("List continue token expired, listing again without pagination", "err", err)
+			reset()
+			listOptions.Limit = 0
+			listOptions.Continue = ""
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if continueToken == "" {
+			return nil
+		}
+		listOptions.Continue = continueToken
+	}
+}
+
+func listNamespaces(ctx context.Context, clientset kubernetes.Interface, listOptions metav1.ListOptions, logger *slog.Logger) ([]v1.Namespace, error) {
+	if objectCache == nil {
+		namespaces := []v1.Namespace{}
+		err := listPages(ctx, listOptions, logger, func(ctx context.Context, listOptions metav1.ListOptions) (string, error) {
+			page, err := clientset.CoreV1().Namespaces().List(ctx, listOptions)
+			if err != nil {
+				return "", err
+			}
+			namespaces = append(namespaces, page.Items...)
+			return page.Continue, nil
+		}, func() { namespaces = namespaces[:0] })
+		return namespaces, err
+	}
+	selector, err := labels.Parse(listOptions.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := objectCache.namespaces.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := []v1.Namespace{}
+	for _, namespace := range cached {
+		namespaces = append(namespaces, *namespace)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	return namespaces, nil
+}
+
+func listPods(ctx context.Context, clientset kubernetes.Interface, namespace string, listOptions metav1.ListOptions, logger *slog.Logger) ([]v1.Pod, error) {
+	factory := objectCache.factory(namespace)
+	if factory == nil {
+		pods := []v1.Pod{}
+		err := listPages(ctx, listOptions, logger, func(ctx context.Context, listOptions metav1.ListOptions) (string, error) {
+			page, err := clientset.CoreV1().Pods(namespace).List(ctx, listOptions)
+			if err != nil {
+				return "", err
+			}
+			pods = append(pods, page.Items...)
+			return page.Continue, nil
+		}, func() { pods = pods[:0] })
+		return pods, err
+	}
+	selector, err := labels.Parse(listOptions.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	cached, err := factory.Core().V1().Pods().Lister().Pods(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	pods := []v1.Pod{}
+	for _, pod := range cached {
+		pods = append(pods, *pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Namespace+"/"+pods[i].Name < pods[j].Namespace+"/"+pods[j].Name
+	})
+	return pods, nil
+}
+
+// listObjectMetadata lists the metadata of services, config maps or secrets.
+// Only metadata is requested so the reaper never reads secret data.
+func listObjectMetadata(ctx context.Context, metadataClient metadata.Interface, objectType string, namespace string, listOptions metav1.ListOptions, logger *slog.Logger) ([]metav1.ObjectMeta, error) {
+	resource := objectResource(objectType)
+	objects := []metav1.ObjectMeta{}
+	if factory := objectCache.metadataFactory(namespace); factory != nil {
+		selector, err := labels.Parse(listOptions.LabelSelector)
+		if err != nil {
+			return nil, err
+		}
+		cached, err := factory.ForResource(resource).Lister().ByNamespace(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range cached {
+			if object, ok := obj.(*metav1.PartialObjectMetadata); ok {
+				objects = append(objects, object.ObjectMeta)
+			}
+		}
+		sort.Slice(objects, func(i, j int) bool {
+			return objects[i].Namespace+"/"+objects[i].Name < objects[j].Namespace+"/"+objects[j].Name
+		})
+		return objects, nil
+	}
+	err := listPages(ctx, listOptions, logger, func(ctx context.Context, listOptions metav1.ListOptions) (string, error) {
+		page, err := metadataClient.Resource(resource).Namespace(namespace).List(ctx, listOptions)
+		if err != nil {
+			return "", err
+		}
+		for _, object := range page.Items {
+			objects = append(objects, object.ObjectMeta)
+		}
+		return page.Continue, nil
+	}, func() { objects = objects[:0] })
+	return objects, err
+}
+
+func objectResource(objectType string) schema.GroupVersionResource {
+	return v1.SchemeGroupVersion.WithResource(objectType + "s")
+}
+
+// getFlagValues returns the current values of flags that can be set by the config file.
+func getFlagValues() map[string]string {
+	values := make(map[string]string)
+	for _, flag := range kingpin.CommandLine.Model().Flags {
+		if sliceContains(staticFlags, flag.Name) {
+			continue
+		}
+		values[flag.Name] = flag.Value.String()
+	}
+	return values
+}
+
+// setFlagValues sets flags by name, returning the first value that fails to parse.
+func setFlagValues(values map[string]string) error {
+	for name, val := range values {
+		flag := kingpin.CommandLine.GetFlag(name)
+		if flag == nil || sliceContains(staticFlags, name) {
+			return fmt.Errorf("flag %s can not be set by config file", name)
+		}
+		if err := flag.Model().Value.Set(val); err != nil {
+			return fmt.Errorf("invalid value %q for flag %s: %w", val, name, err)
+		}
+	}
+	return nil
+}
+
+// loadConfig reads a YAML or JSON config file of flag names and values.
+// Lists are joined with commas, so reap-namespaces may be given as a list.
+func loadConfig(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	config := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", file, err)
+	}
+	values := make(map[string]string)
+	for name, val := range config {
+		switch val := val.(type) {
+		case []interface{}:
+			items := []string{}
+			for _, item := range val {
+				items = append(items, fmt.Sprint(item))
+			}
+			values[name] = strings.Join(items, ",")
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(val)
+		}
+	}
+	return values, nil
+}
+
+// reloadConfig applies the config file over the command line flags and loads the policy file.
+// Settings are only changed if the whole configuration is valid, otherwise the previous settings are kept.
+func reloadConfig(logger *slog.Logger) error {
+	previous := getFlagValues()
+	policy, err := applyConfig()
+	if err != nil {
+		if restoreErr := setFlagValues(previous); restoreErr != nil {
+			logger.Error("Error restoring previous configuration", "err", restoreErr)
+		}
+		logger.Error("Error loading configuration, keeping previous configuration", "err", err)
+		metricErrorsTotal.Inc()
+		metricConfigReloadsTotal.WithLabelValues("failure").Inc()
+		metricConfigLastReloadSuccess.Set(0)
+		return err
+	}
+	reapingPolicy = policy
+	if *configFile != "" || *policyFile != "" {
+		logger.Info("Loaded configuration", "config_file", *configFile, "policy_file", *policyFile)
+		metricConfigReloadsTotal.WithLabelValues("success").Inc()
+	}
+	metricConfigLastReloadSuccess.Set(1)
+	return nil
+}
+
+func applyConfig() (*reapPolicy, error) {
+	if err := setFlagValues(flagDefaults); err != nil {
+		return nil, err
+	}
+	if *configFile != "" {
+		values, err := loadConfig(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := setFlagValues(values); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := parseBudgets(*namespaceReapMax, nil); err != nil {
+		return nil, err
+	}
+	if _, err := parseBudgets(*typeReapMax, reapTypes); err != nil {
+		return nil, err
+	}
+	if *policyFile == "" {
+		return nil, nil
+	}
+	return loadPolicy(*policyFile)
+}
+
+// getConfigChecksum returns a checksum of the config and policy files used to detect changes.
+func getConfigChecksum() string {
+	hash := sha256.New()
+	for _, file := range []string{*configFile, *policyFile} {
+		if file == "" {
+			continue
+		}
+		data, _ := os.ReadFile(file)
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
 func metricGathers() prometheus.Gatherers {
@@ -513,6 +2322,15 @@ func metricGathers() prometheus.Gatherers {
 	registry.MustRegister(metricReapedTotal)
 	registry.MustRegister(metricError)
 	registry.MustRegister(metricErrorsTotal)
+	registry.MustRegister(metricAnnotationErrorsTotal)
+	registry.MustRegister(metricExtensionsRefusedTotal)
+	registry.MustRegister(metricClampedTotal)
+	registry.MustRegister(metricBacklog)
+	registry.MustRegister(metricConfigReloadsTotal)
+	registry.MustRegister(metricConfigLastReloadSuccess)
+	registry.MustRegister(metricLeader)
+	registry.MustRegister(metricRunsAbortedTotal)
+	registry.MustRegister(metricDeleteRetriesTotal)
 	registry.MustRegister(metricDuration)
 	gatherers := prometheus.Gatherers{registry}
 	if *processMetrics {
@@ -15,20 +15,33 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/metadata"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 var (
@@ -36,6 +49,50 @@ var (
 	podStartTime = metav1.NewTime(podStart)
 )
 
+// newMetadataClient returns a fake metadata client reading the objects of a fake clientset.
+func newMetadataClient(clientset kubernetes.Interface) metadata.Interface {
+	tracker := clientset.(*fake.Clientset).Tracker()
+	kinds := map[string]string{"services": "Service", "configmaps": "ConfigMap", "secrets": "Secret"}
+	scheme := metadatafake.NewTestScheme()
+	metav1.AddMetaToScheme(scheme)
+	client := metadatafake.NewSimpleMetadataClient(scheme)
+	client.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gvr := action.GetResource()
+		obj, err := tracker.List(gvr, gvr.GroupVersion().WithKind(kinds[gvr.Resource]), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		items, err := meta.ExtractList(obj)
+		if err != nil {
+			return true, nil, err
+		}
+		list := &metav1.List{}
+		for _, item := range items {
+			list.Items = append(list.Items, runtime.RawExtension{Object: partialObjectMetadata(item)})
+		}
+		return true, list, nil
+	})
+	client.PrependWatchReactor("*", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w, err := tracker.Watch(action.GetResource(), action.GetNamespace())
+		if err != nil {
+			return true, nil, err
+		}
+		return true, watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+			event.Object = partialObjectMetadata(event.Object)
+			return event, true
+		}), nil
+	})
+	return client
+}
+
+func partialObjectMetadata(obj runtime.Object) runtime.Object {
+	accessor, ok := obj.(metav1.ObjectMetaAccessor)
+	if !ok {
+		return obj
+	}
+	return &metav1.PartialObjectMetadata{ObjectMeta: *accessor.GetObjectMeta().(*metav1.ObjectMeta)}
+}
+
 func clientset() kubernetes.Interface {
 	clientset := fake.NewSimpleClientset(&v1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
@@ -210,7 +267,7 @@ func TestGetNamespaces(t *testing.T) {
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
 	clientset := clientset()
-	namespaces, err := getNamespaces(clientset, logger)
+	namespaces, err := getNamespaces(context.TODO(), clientset, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -228,7 +285,7 @@ func TestGetNamespacesByLabel(t *testing.T) {
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
 	clientset := clientset()
-	namespaces, err := getNamespaces(clientset, logger)
+	namespaces, err := getNamespaces(context.TODO(), clientset, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -252,11 +309,11 @@ func TestGetJobs(t *testing.T) {
 	}
 
 	clientset := clientset()
-	namespaces, err := getNamespaces(clientset, logger)
+	namespaces, err := getNamespaces(context.TODO(), clientset, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	jobs, jobIDs, err := getJobs(clientset, namespaces, logger)
+	jobs, jobIDs, _, err := getJobs(context.TODO(), clientset, namespaces, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -294,11 +351,11 @@ func TestGetJobsCase1(t *testing.T) {
 	}
 
 	clientset := clientset()
-	namespaces, err := getNamespaces(clientset, logger)
+	namespaces, err := getNamespaces(context.TODO(), clientset, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	jobs, _, err := getJobs(clientset, namespaces, logger)
+	jobs, _, _, err := getJobs(context.TODO(), clientset, namespaces, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -323,11 +380,11 @@ func TestGetJobsNoPodLabels(t *testing.T) {
 	}
 
 	clientset := clientset()
-	namespaces, err := getNamespaces(clientset, logger)
+	namespaces, err := getNamespaces(context.TODO(), clientset, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	jobs, _, err := getJobs(clientset, namespaces, logger)
+	jobs, _, _, err := getJobs(context.TODO(), clientset, namespaces, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -358,11 +415,11 @@ func TestGetJobsNamespaceLabels(t *testing.T) {
 	}
 
 	clientset := clientset()
-	namespaces, err := getNamespaces(clientset, logger)
+	namespaces, err := getNamespaces(context.TODO(), clientset, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	jobs, _, err := getJobs(clientset, namespaces, logger)
+	jobs, _, _, err := getJobs(context.TODO(), clientset, namespaces, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -387,11 +444,11 @@ func TestGetJobsNoJobLabel(t *testing.T) {
 	}
 
 	clientset := clientset()
-	namespaces, err := getNamespaces(clientset, logger)
+	namespaces, err := getNamespaces(context.TODO(), clientset, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	jobs, jobIDs, err := getJobs(clientset, namespaces, logger)
+	jobs, jobIDs, _, err := getJobs(context.TODO(), clientset, namespaces, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -418,8 +475,8 @@ func TestGetJobsNoJobLabel(t *testing.T) {
 	}
 }
 
-func TestRunOnDemand(t *testing.T) {
-	if _, err := kingpin.CommandLine.Parse([]string{"--object-labels=app.kubernetes.io/managed-by=open-ondemand"}); err != nil {
+func TestGetJobsExpiresAt(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
 		t.Fatal(err)
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
@@ -429,64 +486,67 @@ func TestRunOnDemand(t *testing.T) {
 		return t
 	}
 
-	resetCounters()
-	clientset := clientset()
-	err := run(clientset, logger)
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expires-at-past",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/expires-at": "2020-01-01T14:00:00Z",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expires-at-future",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/expires-at": "2020-01-01T16:00:00Z",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expires-at-before-lifetime",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime":   "24h",
+				"pod.kubernetes.io/expires-at": "2020-01-01T14:00:00Z",
+			},
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lifetime-before-expires-at",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime":   "1h",
+				"pod.kubernetes.io/expires-at": "2020-01-02T00:00:00Z",
+			},
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+	})
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting pods: %v", err)
-	}
-	if len(pods.Items) != 3 {
-		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
-	}
-	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting services: %v", err)
-	}
-	if len(services.Items) != 1 {
-		t.Errorf("Unexpected number of services, got: %d", len(services.Items))
-	}
-	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting configmaps: %v", err)
-	}
-	if len(configmaps.Items) != 0 {
-		t.Errorf("Unexpected number of services, got: %d", len(configmaps.Items))
-	}
-	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting secrets: %v", err)
-	}
-	if len(secrets.Items) != 0 {
-		t.Errorf("Unexpected number of secrets, got: %d", len(secrets.Items))
+	jobIDs := []string{}
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.jobID)
 	}
-
-	expected := `
-	# HELP job_pod_reaper_error Indicates an error was encountered
-	# TYPE job_pod_reaper_error gauge
-	job_pod_reaper_error 0
-	# HELP job_pod_reaper_errors_total Total number of errors
-	# TYPE job_pod_reaper_errors_total counter
-	job_pod_reaper_errors_total 0
-	# HELP job_pod_reaper_reaped_total Total number of object types reaped
-	# TYPE job_pod_reaper_reaped_total counter
-	job_pod_reaper_reaped_total{type="configmap"} 3
-	job_pod_reaper_reaped_total{type="pod"} 2
-	job_pod_reaper_reaped_total{type="secret"} 3
-	job_pod_reaper_reaped_total{type="service"} 3
-	`
-
-	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
-		"job_pod_reaper_reaped_total", "job_pod_reaper_error", "job_pod_reaper_errors_total"); err != nil {
-		t.Errorf("unexpected collecting result:\n%s", err)
+	expectedJobIDs := []string{"1", "3", "4"}
+	sort.Strings(jobIDs)
+	if !reflect.DeepEqual(jobIDs, expectedJobIDs) {
+		t.Errorf("Unexpected value for jobIDs\nExpected %v\nGot %v\n", expectedJobIDs, jobIDs)
 	}
 }
 
-func TestRun(t *testing.T) {
-	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+func TestGetJobsLifetimeBasis(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--lifetime-basis=start"}); err != nil {
 		t.Fatal(err)
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
@@ -496,64 +556,208 @@ func TestRun(t *testing.T) {
 		return t
 	}
 
-	resetCounters()
-	clientset := clientset()
-	err := run(clientset, logger)
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "started-late",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			StartTime: &metav1.Time{Time: podStart.Add(90 * time.Minute)},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "started-early",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			StartTime: &metav1.Time{Time: podStart.Add(30 * time.Minute)},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "not-started",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+			},
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "basis-creation",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime":    "1h",
+				"job-pod-reaper/lifetime-basis": "creation",
+			},
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			StartTime: &metav1.Time{Time: podStart.Add(90 * time.Minute)},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "basis-running",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime":    "30m",
+				"job-pod-reaper/lifetime-basis": "running",
+			},
+			Labels:            map[string]string{"job": "5"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			StartTime: &metav1.Time{Time: podStart.Add(30 * time.Minute)},
+			ContainerStatuses: []v1.ContainerStatus{
+				{
+					State: v1.ContainerState{
+						Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(podStart.Add(105 * time.Minute))},
+					},
+				},
+			},
+		},
+	})
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting pods: %v", err)
+	jobIDs := []string{}
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.jobID)
 	}
-	if len(pods.Items) != 2 {
-		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	expectedJobIDs := []string{"2", "4"}
+	sort.Strings(jobIDs)
+	if !reflect.DeepEqual(jobIDs, expectedJobIDs) {
+		t.Errorf("Unexpected value for jobIDs\nExpected %v\nGot %v\n", expectedJobIDs, jobIDs)
 	}
-	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting services: %v", err)
+}
+
+func TestGetJobsExtensions(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--max-extended-lifetime=90m"}); err != nil {
+		t.Fatal(err)
 	}
-	if len(services.Items) != 1 {
-		t.Errorf("Unexpected number of services, got: %d", len(services.Items))
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
 	}
-	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+
+	metricExtensionsRefusedTotal.Reset()
+	clientset := fake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test2",
+			Annotations: map[string]string{
+				"job-pod-reaper/max-extended-lifetime": "4h",
+			},
+		},
+	}, &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test3",
+			Annotations: map[string]string{
+				"job-pod-reaper/max-lifetime": "2h",
+			},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "extension-refused",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+				"job-pod-reaper/extend-by":   "1h,15m",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "extension-namespace-max",
+			Namespace: "test2",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+				"job-pod-reaper/extend-by":   "2h",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "extension-namespace-refused",
+			Namespace: "test2",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+				"job-pod-reaper/extend-by":   "4h",
+			},
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "extension-max-lifetime-refused",
+			Namespace: "test3",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+				"job-pod-reaper/extend-by":   "87600h",
+			},
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test", "test2", "test3"}, logger)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		jobIDs := []string{}
+		for _, job := range jobs {
+			jobIDs = append(jobIDs, job.jobID)
+		}
+		expectedJobIDs := []string{"1", "3", "4"}
+		sort.Strings(jobIDs)
+		if !reflect.DeepEqual(jobIDs, expectedJobIDs) {
+			t.Errorf("Unexpected value for jobIDs\nExpected %v\nGot %v\n", expectedJobIDs, jobIDs)
+		}
+	}
+	pod, err := clientset.CoreV1().Pods("test").Get(context.TODO(), "extension-refused", metav1.GetOptions{})
 	if err != nil {
-		t.Errorf("Unexpected error getting configmaps: %v", err)
-	}
-	if len(configmaps.Items) != 0 {
-		t.Errorf("Unexpected number of services, got: %d", len(configmaps.Items))
+		t.Fatalf("Unexpected error getting pod: %v", err)
 	}
-	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting secrets: %v", err)
+	if val := pod.Annotations["job-pod-reaper/extensions"]; val != "1" {
+		t.Errorf("Unexpected extensions annotation, got: %v", val)
 	}
-	if len(secrets.Items) != 0 {
-		t.Errorf("Unexpected number of secrets, got: %d", len(secrets.Items))
+	if val := pod.Annotations["job-pod-reaper/extensions-refused"]; val != "1" {
+		t.Errorf("Unexpected extensions-refused annotation, got: %v", val)
 	}
 
 	expected := `
-	# HELP job_pod_reaper_error Indicates an error was encountered
-	# TYPE job_pod_reaper_error gauge
-	job_pod_reaper_error 0
-	# HELP job_pod_reaper_errors_total Total number of errors
-	# TYPE job_pod_reaper_errors_total counter
-	job_pod_reaper_errors_total 0
-	# HELP job_pod_reaper_reaped_total Total number of object types reaped
-	# TYPE job_pod_reaper_reaped_total counter
-	job_pod_reaper_reaped_total{type="configmap"} 3
-	job_pod_reaper_reaped_total{type="pod"} 3
-	job_pod_reaper_reaped_total{type="secret"} 3
-	job_pod_reaper_reaped_total{type="service"} 3
+	# HELP job_pod_reaper_extensions_refused_total Total number of lifetime extensions refused for exceeding the maximum extended lifetime
+	# TYPE job_pod_reaper_extensions_refused_total counter
+	job_pod_reaper_extensions_refused_total{namespace="test"} 1
+	job_pod_reaper_extensions_refused_total{namespace="test2"} 1
+	job_pod_reaper_extensions_refused_total{namespace="test3"} 1
 	`
 
 	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
-		"job_pod_reaper_reaped_total", "job_pod_reaper_error", "job_pod_reaper_errors_total"); err != nil {
+		"job_pod_reaper_extensions_refused_total"); err != nil {
 		t.Errorf("unexpected collecting result:\n%s", err)
 	}
 }
 
-func TestRunNoJobLabel(t *testing.T) {
-	if _, err := kingpin.CommandLine.Parse([]string{"--job-label=none"}); err != nil {
+func TestGetJobsDefaultLifetime(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--default-lifetime=1h"}); err != nil {
 		t.Fatal(err)
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
@@ -563,28 +767,2161 @@ func TestRunNoJobLabel(t *testing.T) {
 		return t
 	}
 
-	resetCounters()
-	clientset := clientset()
-	err := run(clientset, logger)
+	clientset := fake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test2",
+			Annotations: map[string]string{
+				"job-pod-reaper/default-lifetime": "3h",
+			},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "default-lifetime",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "namespace-default-lifetime",
+			Namespace:         "test2",
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "own-lifetime",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "3h",
+			},
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "own-expires-at",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/expires-at": "2020-01-01T16:00:00Z",
+			},
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+	})
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test", "test2"}, logger)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
-	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting pods: %v", err)
-	}
-	if len(pods.Items) != 1 {
-		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	jobIDs := []string{}
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.jobID)
 	}
-	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		t.Errorf("Unexpected error getting services: %v", err)
+	expectedJobIDs := []string{"1"}
+	if !reflect.DeepEqual(jobIDs, expectedJobIDs) {
+		t.Errorf("Unexpected value for jobIDs\nExpected %v\nGot %v\n", expectedJobIDs, jobIDs)
 	}
-	if len(services.Items) != 4 {
-		t.Errorf("Unexpected number of services, got: %d", len(services.Items))
+}
+
+func TestGetJobsMaxLifetime(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--max-lifetime=1h"}); err != nil {
+		t.Fatal(err)
 	}
-	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	metricClampedTotal.Reset()
+	clientset := fake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test2",
+			Annotations: map[string]string{
+				"job-pod-reaper/max-lifetime": "4h",
+			},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lifetime-clamped",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "87600h",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expires-at-clamped",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/expires-at": "2100-01-01T00:00:00Z",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "namespace-max-lifetime",
+			Namespace: "test2",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "3h",
+			},
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "namespace-max-lifetime-clamped",
+			Namespace: "test2",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "24h",
+			},
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test", "test2"}, logger)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		jobIDs := []string{}
+		for _, job := range jobs {
+			jobIDs = append(jobIDs, job.jobID)
+		}
+		expectedJobIDs := []string{"1", "2"}
+		sort.Strings(jobIDs)
+		if !reflect.DeepEqual(jobIDs, expectedJobIDs) {
+			t.Errorf("Unexpected value for jobIDs\nExpected %v\nGot %v\n", expectedJobIDs, jobIDs)
+		}
+	}
+
+	expected := `
+	# HELP job_pod_reaper_lifetimes_clamped_total Total number of pods whose lifetime was clamped to the maximum lifetime
+	# TYPE job_pod_reaper_lifetimes_clamped_total counter
+	job_pod_reaper_lifetimes_clamped_total{namespace="test"} 2
+	job_pod_reaper_lifetimes_clamped_total{namespace="test2"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_lifetimes_clamped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestGetJobsWarning(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--warning-window=1h", "--warning-annotation"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expiring",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "2h30m",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "not-expiring",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "4h",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+	})
+
+	for _, now := range []string{"15:00:00", "15:00:00", "15:00:20"} {
+		timeNow = func() time.Time {
+			t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 "+now)
+			return t
+		}
+		jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if len(jobs) != 0 {
+			t.Errorf("Expected 0 jobs, got %d", len(jobs))
+		}
+	}
+	creates, patches := 0, 0
+	for _, action := range clientset.Actions() {
+		if action.Matches("create", "events") {
+			creates++
+		}
+		if action.Matches("patch", "pods") {
+			patches++
+		}
+	}
+	if creates != 1 || patches != 1 {
+		t.Errorf("Expected 1 event created and 1 pod patched, got %d and %d", creates, patches)
+	}
+	events, err := clientset.CoreV1().Events("test").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting events: %v", err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("Unexpected number of events, got: %d", len(events.Items))
+	}
+	if val := events.Items[0].InvolvedObject.Name; val != "expiring" {
+		t.Errorf("Unexpected event pod, got: %v", val)
+	}
+	if val := events.Items[0].Type; val != v1.EventTypeWarning {
+		t.Errorf("Unexpected event type, got: %v", val)
+	}
+	pod, err := clientset.CoreV1().Pods("test").Get(context.TODO(), "expiring", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting pod: %v", err)
+	}
+	if val := pod.Annotations["job-pod-reaper/expires-in"]; val != "30m0s" {
+		t.Errorf("Unexpected expires-in annotation, got: %v", val)
+	}
+	pod, err = clientset.CoreV1().Pods("test").Get(context.TODO(), "not-expiring", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting pod: %v", err)
+	}
+	if val, ok := pod.Annotations["job-pod-reaper/expires-in"]; ok {
+		t.Errorf("Unexpected expires-in annotation, got: %v", val)
+	}
+}
+
+func TestGetJobsTTLAfterFinished(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--ttl-after-finished=1h"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	terminated := func(finished time.Duration) []v1.ContainerStatus {
+		return []v1.ContainerStatus{
+			{
+				State: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{FinishedAt: metav1.NewTime(podStart.Add(finished))},
+				},
+			},
+		}
+	}
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "succeeded-expired",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodSucceeded,
+			ContainerStatuses: terminated(30 * time.Minute),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "failed-not-expired",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodFailed,
+			ContainerStatuses: terminated(90 * time.Minute),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "succeeded-annotation",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"job-pod-reaper/ttl-after-finished": "10m",
+			},
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodSucceeded,
+			ContainerStatuses: terminated(105 * time.Minute),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "running",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+		},
+	})
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	jobIDs := []string{}
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.jobID)
+	}
+	expectedJobIDs := []string{"1", "3"}
+	sort.Strings(jobIDs)
+	if !reflect.DeepEqual(jobIDs, expectedJobIDs) {
+		t.Errorf("Unexpected value for jobIDs\nExpected %v\nGot %v\n", expectedJobIDs, jobIDs)
+	}
+}
+
+func TestRunPending(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--pending-timeout=1h"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pending",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "unschedulable",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+			Conditions: []v1.PodCondition{
+				{
+					Type:   v1.PodScheduled,
+					Status: v1.ConditionFalse,
+					Reason: v1.PodReasonUnschedulable,
+				},
+			},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "pending-recent",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: metav1.NewTime(podStart.Add(90 * time.Minute)),
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodPending,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "running",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+		},
+	}, &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-job2",
+			Namespace: "test",
+			Labels:    map[string]string{"job": "2"},
+		},
+	})
+
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 2 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+
+	expected := `
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 0
+	job_pod_reaper_reaped_total{reason="pending",type="pod"} 1
+	job_pod_reaper_reaped_total{reason="unschedulable",type="pod"} 1
+	job_pod_reaper_reaped_total{reason="unschedulable",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestGetJobsRestarts(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--restart-limit=5", "--crashloop-timeout=10m"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "restart-storm",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: []v1.ContainerStatus{
+				{RestartCount: 6},
+			},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "restarts-below-limit",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: []v1.ContainerStatus{
+				{RestartCount: 3},
+			},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "crashloop",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: []v1.ContainerStatus{
+				{
+					RestartCount: 2,
+					State: v1.ContainerState{
+						Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+					},
+				},
+			},
+		},
+	})
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 jobs, got %d", len(jobs))
+	}
+	if val := jobs[0].jobID; val != "1" {
+		t.Errorf("Unexpected jobID, got: %v", val)
+	}
+	if val := jobs[0].reason; val != "restarts" {
+		t.Errorf("Unexpected reason, got: %v", val)
+	}
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:11:00")
+		return t
+	}
+	jobs, _, _, err = getJobs(context.TODO(), clientset, []string{"test"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	reasons := map[string]string{}
+	for _, job := range jobs {
+		reasons[job.jobID] = job.reason
+	}
+	expectedReasons := map[string]string{"1": "restarts", "3": "crashloop"}
+	if !reflect.DeepEqual(reasons, expectedReasons) {
+		t.Errorf("Unexpected value for reasons\nExpected %v\nGot %v\n", expectedReasons, reasons)
+	}
+}
+
+func TestGetJobsCrashLoopCycles(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--crashloop-timeout=30m"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "crashloop-cycles",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+	for i := 0; i <= 8; i++ {
+		now := podStart.Add(time.Duration(i) * 5 * time.Minute)
+		timeNow = func() time.Time {
+			return now
+		}
+		state := v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+		if i%2 == 1 {
+			state = v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: metav1.NewTime(now)}}
+		}
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{{RestartCount: int32(i/2 + 1), State: state}}
+		if _, err := clientset.CoreV1().Pods("test").UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+			t.Fatalf("Unexpected error updating pod: %v", err)
+		}
+		jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		expired := i*5 > 30
+		if expired && (len(jobs) != 1 || jobs[0].reason != "crashloop") {
+			t.Errorf("Expected pod to be reaped for crashloop after %d minutes, got: %v", i*5, jobs)
+		} else if !expired && len(jobs) != 0 {
+			t.Errorf("Unexpected jobs after %d minutes, got: %v", i*5, jobs)
+		}
+	}
+}
+
+func TestGetJobsRestartWindow(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--restart-limit=5", "--restart-window=1h"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "restart-storm",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:     v1.PodRunning,
+			StartTime: &podStartTime,
+			ContainerStatuses: []v1.ContainerStatus{
+				{RestartCount: 10},
+			},
+		},
+	}
+	clientset := fake.NewSimpleClientset(pod)
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("Expected 0 jobs, got %d", len(jobs))
+	}
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:30:00")
+		return t
+	}
+	pod.Status.ContainerStatuses[0].RestartCount = 17
+	if _, err := clientset.CoreV1().Pods("test").UpdateStatus(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Unexpected error updating pod: %v", err)
+	}
+	jobs, _, _, err = getJobs(context.TODO(), clientset, []string{"test"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Expected 1 jobs, got %d", len(jobs))
+	}
+	if val := jobs[0].reason; val != "restarts" {
+		t.Errorf("Unexpected reason, got: %v", val)
+	}
+}
+
+func TestRunTerminated(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--evicted-grace-period=5m", "--oomkilled-grace-period=5m"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	terminated := func(reason string, finished time.Duration) []v1.ContainerStatus {
+		return []v1.ContainerStatus{
+			{
+				State: v1.ContainerState{
+					Terminated: &v1.ContainerStateTerminated{Reason: reason, FinishedAt: metav1.NewTime(podStart.Add(finished))},
+				},
+			},
+		}
+	}
+	resetCounters()
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "evicted",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodFailed,
+			Reason:            "Evicted",
+			ContainerStatuses: terminated("Error", 110*time.Minute),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "oomkilled",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodFailed,
+			ContainerStatuses: terminated("OOMKilled", 100*time.Minute),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "oomkilled-recent",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodFailed,
+			ContainerStatuses: terminated("OOMKilled", 118*time.Minute),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "failed",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase:             v1.PodFailed,
+			ContainerStatuses: terminated("Error", 30*time.Minute),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "oomkilled-running",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "5"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{
+			Phase: v1.PodRunning,
+			ContainerStatuses: append(terminated("OOMKilled", 100*time.Minute), v1.ContainerStatus{
+				State: v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: podStartTime}},
+			}),
+		},
+	})
+
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 3 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+
+	expected := `
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="evicted",type="pod"} 1
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 0
+	job_pod_reaper_reaped_total{reason="oomkilled",type="pod"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRunReapJobPods(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--reap-job-pods"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "driver",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "executor-1",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "24h",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "executor-2",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other-job",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "24h",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "other-namespace",
+			Namespace:         "test2",
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-job1",
+			Namespace: "test",
+			Labels:    map[string]string{"job": "1"},
+		},
+	})
+
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	podNames := []string{}
+	for _, pod := range pods.Items {
+		podNames = append(podNames, pod.Name)
+	}
+	expectedPodNames := []string{"other-job", "other-namespace"}
+	sort.Strings(podNames)
+	if !reflect.DeepEqual(podNames, expectedPodNames) {
+		t.Errorf("Unexpected value for pods\nExpected %v\nGot %v\n", expectedPodNames, podNames)
+	}
+
+	expected := `
+	# HELP job_pod_reaper_error Indicates an error was encountered
+	# TYPE job_pod_reaper_error gauge
+	job_pod_reaper_error 0
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 3
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total", "job_pod_reaper_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestParseLifetime(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30m":        30 * time.Minute,
+		"1h30m":      90 * time.Minute,
+		"7d":         7 * 24 * time.Hour,
+		"1w":         7 * 24 * time.Hour,
+		"1.5d":       36 * time.Hour,
+		"1w2d12h":    9*24*time.Hour + 12*time.Hour,
+		"P1DT12H":    36 * time.Hour,
+		"PT30M":      30 * time.Minute,
+		"P1W":        7 * 24 * time.Hour,
+		"P2D":        48 * time.Hour,
+		"PT1H30M15S": 90*time.Minute + 15*time.Second,
+	}
+	for val, expected := range tests {
+		lifetime, err := parseLifetime(val)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", val, err)
+			continue
+		}
+		if lifetime != expected {
+			t.Errorf("Unexpected lifetime for %s\nExpected %v\nGot %v", val, expected, lifetime)
+		}
+	}
+	for _, val := range []string{"", "1", "foo", "7days", "P", "PT", "P1Y", "P1M", "P1DT", "1h7d", "999999w", "P999999D", "106752d", "106751d24h", "PT9223372037S"} {
+		if _, err := parseLifetime(val); err == nil {
+			t.Errorf("Expected error parsing %q", val)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{name: "valid", policy: "rules:\n- name: users\n  namespaces: [\"user-*\"]\n  podSelector: app=ondemand\n  lifetime: 1d\n  ttlAfterFinished: 30m\n  relatedObjects: [service]\n"},
+		{name: "json", policy: `{"rules": [{"name": "all", "maxLifetime": "P1W"}]}`},
+		{name: "unknown field", policy: "rules:\n- name: users\n  lifetme: 1h\n", wantErr: true},
+		{name: "invalid namespace", policy: "rules:\n- namespaces: [\"user-[\"]\n", wantErr: true},
+		{name: "invalid selector", policy: "rules:\n- podSelector: \"app in (\"\n", wantErr: true},
+		{name: "invalid duration", policy: "rules:\n- lifetime: forever\n", wantErr: true},
+		{name: "invalid related object", policy: "rules:\n- relatedObjects: [deployment]\n", wantErr: true},
+	}
+	for _, test := range tests {
+		file := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(file, []byte(test.policy), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadPolicy(file)
+		if test.wantErr && err == nil {
+			t.Errorf("Expected error loading policy %s", test.name)
+		} else if !test.wantErr && err != nil {
+			t.Errorf("Unexpected error loading policy %s: %v", test.name, err)
+		}
+	}
+	if _, err := loadPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("Expected error loading missing policy file")
+	}
+}
+
+func TestListPages(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--page-size=2"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	pages := map[string][]string{"": {"a", "b"}, "page2": {"c", "d"}, "page3": {"e"}}
+	continueTokens := map[string]string{"": "page2", "page2": "page3", "page3": ""}
+	items := []string{}
+	limits := []int64{}
+	err := listPages(context.TODO(), metav1.ListOptions{LabelSelector: "job"}, logger, func(ctx context.Context, listOptions metav1.ListOptions) (string, error) {
+		if listOptions.LabelSelector != "job" {
+			t.Errorf("Unexpected label selector: %s", listOptions.LabelSelector)
+		}
+		limits = append(limits, listOptions.Limit)
+		items = append(items, pages[listOptions.Continue]...)
+		return continueTokens[listOptions.Continue], nil
+	}, func() { items = items[:0] })
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(items, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("Unexpected items, got: %v", items)
+	}
+	if !reflect.DeepEqual(limits, []int64{2, 2, 2}) {
+		t.Errorf("Unexpected limits, got: %v", limits)
+	}
+
+	items = []string{}
+	limits = []int64{}
+	err = listPages(context.TODO(), metav1.ListOptions{}, logger, func(ctx context.Context, listOptions metav1.ListOptions) (string, error) {
+		limits = append(limits, listOptions.Limit)
+		if listOptions.Continue == "page2" {
+			return "", apierrors.NewResourceExpired("continue token expired")
+		}
+		if listOptions.Limit == 0 {
+			items = append(items, "a", "b", "c", "d", "e")
+			return "", nil
+		}
+		items = append(items, pages[listOptions.Continue]...)
+		return continueTokens[listOptions.Continue], nil
+	}, func() { items = items[:0] })
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(items, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("Unexpected items after expired continue token, got: %v", items)
+	}
+	if !reflect.DeepEqual(limits, []int64{2, 2, 0}) {
+		t.Errorf("Unexpected limits after expired continue token, got: %v", limits)
+	}
+
+	err = listPages(context.TODO(), metav1.ListOptions{}, logger, func(ctx context.Context, listOptions metav1.ListOptions) (string, error) {
+		return "", apierrors.NewResourceExpired("resource version too old")
+	}, func() {})
+	if !apierrors.IsResourceExpired(err) {
+		t.Errorf("Expected expired error without continue token to be returned, got: %v", err)
+	}
+}
+
+func TestRunOnDemand(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--object-labels=app.kubernetes.io/managed-by=open-ondemand"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 3 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting services: %v", err)
+	}
+	if len(services.Items) != 1 {
+		t.Errorf("Unexpected number of services, got: %d", len(services.Items))
+	}
+	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting configmaps: %v", err)
+	}
+	if len(configmaps.Items) != 0 {
+		t.Errorf("Unexpected number of services, got: %d", len(configmaps.Items))
+	}
+	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting secrets: %v", err)
+	}
+	if len(secrets.Items) != 0 {
+		t.Errorf("Unexpected number of secrets, got: %d", len(secrets.Items))
+	}
+
+	expected := `
+	# HELP job_pod_reaper_error Indicates an error was encountered
+	# TYPE job_pod_reaper_error gauge
+	job_pod_reaper_error 0
+	# HELP job_pod_reaper_errors_total Total number of errors
+	# TYPE job_pod_reaper_errors_total counter
+	job_pod_reaper_errors_total 0
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 2
+	job_pod_reaper_reaped_total{reason="orphaned",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total", "job_pod_reaper_error", "job_pod_reaper_errors_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 2 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting services: %v", err)
+	}
+	if len(services.Items) != 1 {
+		t.Errorf("Unexpected number of services, got: %d", len(services.Items))
+	}
+	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting configmaps: %v", err)
+	}
+	if len(configmaps.Items) != 0 {
+		t.Errorf("Unexpected number of services, got: %d", len(configmaps.Items))
+	}
+	secrets, err := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting secrets: %v", err)
+	}
+	if len(secrets.Items) != 0 {
+		t.Errorf("Unexpected number of secrets, got: %d", len(secrets.Items))
+	}
+
+	expected := `
+	# HELP job_pod_reaper_error Indicates an error was encountered
+	# TYPE job_pod_reaper_error gauge
+	job_pod_reaper_error 0
+	# HELP job_pod_reaper_errors_total Total number of errors
+	# TYPE job_pod_reaper_errors_total counter
+	job_pod_reaper_errors_total 0
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 3
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 2
+	job_pod_reaper_reaped_total{reason="orphaned",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total", "job_pod_reaper_error", "job_pod_reaper_errors_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRunReapMax(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--reap-max=3"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 4 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	for _, pod := range pods.Items {
+		if pod.Name == "ondemand-job2" {
+			t.Errorf("Expected most overdue pod to be reaped: %s", pod.Name)
+		}
+	}
+
+	expected := `
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 1
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRunReapMaxObjectLabels(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	remaining := func(clientset kubernetes.Interface) []string {
+		names := []string{}
+		pods, _ := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+		for _, pod := range pods.Items {
+			names = append(names, pod.Name)
+		}
+		services, _ := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+		for _, service := range services.Items {
+			names = append(names, service.Name)
+		}
+		configmaps, _ := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+		for _, configmap := range configmaps.Items {
+			names = append(names, configmap.Name)
+		}
+		secrets, _ := clientset.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+		for _, secret := range secrets.Items {
+			names = append(names, secret.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	if _, err := kingpin.CommandLine.Parse([]string{"--object-labels=app.kubernetes.io/managed-by=open-ondemand", "--reap-max=0"}); err != nil {
+		t.Fatal(err)
+	}
+	unlimited := clientset()
+	if err := run(context.TODO(), unlimited, newMetadataClient(unlimited), logger); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if _, err := kingpin.CommandLine.Parse([]string{"--object-labels=app.kubernetes.io/managed-by=open-ondemand", "--reap-max=2"}); err != nil {
+		t.Fatal(err)
+	}
+	clientset := clientset()
+	for i := 0; i < 5; i++ {
+		if err := run(context.TODO(), clientset, newMetadataClient(clientset), logger); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if expected, got := remaining(unlimited), remaining(clientset); !reflect.DeepEqual(expected, got) {
+		t.Errorf("Unexpected objects left after limited runs\nExpected %v\nGot %v", expected, got)
+	}
+}
+
+func TestRunBudgets(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--namespace-reap-max=all=2,user-user3=5", "--type-reap-max=service=1"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	namespace, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "user-user1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting namespace: %v", err)
+	}
+	namespace.Annotations = map[string]string{"job-pod-reaper/reap-max": "1"}
+	if _, err := clientset.CoreV1().Namespaces().Update(context.TODO(), namespace, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Unexpected error updating namespace: %v", err)
+	}
+	err = run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := `
+	# HELP job_pod_reaper_backlog Number of objects eligible for reaping deferred to a later run by a reap budget
+	# TYPE job_pod_reaper_backlog gauge
+	job_pod_reaper_backlog{namespace="user-user1",type="configmap"} 1
+	job_pod_reaper_backlog{namespace="user-user1",type="pod"} 1
+	job_pod_reaper_backlog{namespace="user-user1",type="secret"} 1
+	job_pod_reaper_backlog{namespace="user-user1",type="service"} 1
+	job_pod_reaper_backlog{namespace="user-user2",type="configmap"} 1
+	job_pod_reaper_backlog{namespace="user-user2",type="secret"} 1
+	job_pod_reaper_backlog{namespace="user-user2",type="service"} 1
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total", "job_pod_reaper_backlog"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	for objectType, name := range map[string]string{"pod": "ondemand-job1", "service": "service-job1", "configmap": "configmap-job1", "secret": "secret-job1"} {
+		if !objectExists(clientset, objectType, "user-user1", name) {
+			t.Errorf("Expected %s %s of deferred job to not be reaped", objectType, name)
+		}
+	}
+
+}
+
+func TestRunTypeBudgets(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--type-reap-max=pod=1"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for objectType, name := range map[string]string{"pod": "ondemand-job2", "service": "service-job2", "configmap": "configmap-job2", "secret": "secret-job2"} {
+		if objectExists(clientset, objectType, "user-user2", name) {
+			t.Errorf("Expected %s %s of most overdue job to be reaped", objectType, name)
+		}
+	}
+	for objectType, name := range map[string]string{"pod": "ondemand-job1", "service": "service-job1", "configmap": "configmap-job1", "secret": "secret-job1"} {
+		if !objectExists(clientset, objectType, "user-user1", name) {
+			t.Errorf("Expected %s %s of deferred job to not be reaped", objectType, name)
+		}
+	}
+}
+
+// objectExists returns true if the named object of objectType exists.
+func objectExists(clientset kubernetes.Interface, objectType string, namespace string, name string) bool {
+	var err error
+	switch objectType {
+	case "pod":
+		_, err = clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	case "service":
+		_, err = clientset.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	case "configmap":
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	case "secret":
+		_, err = clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	}
+	return err == nil
+}
+
+func TestRunPolicy(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := `
+rules:
+- name: long-jobs
+  namespaces: ["user-user1"]
+  podSelector: job=1
+  lifetime: 3h
+- name: users
+  namespaces: ["user-*"]
+  relatedObjects: [service]
+`
+	if err := os.WriteFile(file, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	reapingPolicy, err = loadPolicy(file)
+	if err != nil {
+		t.Fatalf("Unexpected error loading policy: %v", err)
+	}
+	defer func() { reapingPolicy = nil }()
+
+	resetCounters()
+	clientset := clientset()
+	err = run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 3 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	configmaps, err := clientset.CoreV1().ConfigMaps("user-user2").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting configmaps: %v", err)
+	}
+	if len(configmaps.Items) != 1 || configmaps.Items[0].Name != "configmap-job2" {
+		t.Errorf("Expected configmap-job2 to not be reaped, got: %v", configmaps.Items)
+	}
+
+	expected := `
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestGetJobsPolicyPrecedence(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := `
+rules:
+- name: capped
+  podSelector: job=1
+  maxLifetime: 1h
+- name: finished
+  podSelector: job=2
+  ttlAfterFinished: 30m
+- name: defaults
+  podSelector: job=3
+  defaultLifetime: 1h
+`
+	if err := os.WriteFile(file, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	reapingPolicy, err = loadPolicy(file)
+	if err != nil {
+		t.Fatalf("Unexpected error loading policy: %v", err)
+	}
+	defer func() { reapingPolicy = nil }()
+
+	clientset := fake.NewSimpleClientset(&v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+			Annotations: map[string]string{
+				"job-pod-reaper/max-lifetime":     "10h",
+				"job-pod-reaper/default-lifetime": "5h",
+			},
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rule-max-lifetime",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "3h",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rule-ttl-after-finished",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"job-pod-reaper/ttl-after-finished": "10h",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{Phase: v1.PodSucceeded},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "rule-default-lifetime",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "namespace-max-lifetime",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "3h",
+			},
+			Labels:            map[string]string{"job": "4"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "namespace-default-lifetime",
+			Namespace:         "test",
+			Labels:            map[string]string{"job": "5"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod-ttl-after-finished",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"job-pod-reaper/ttl-after-finished": "10m",
+			},
+			Labels:            map[string]string{"job": "6"},
+			CreationTimestamp: podStartTime,
+		},
+		Status: v1.PodStatus{Phase: v1.PodSucceeded},
+	})
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	jobIDs := []string{}
+	for _, job := range jobs {
+		jobIDs = append(jobIDs, job.jobID)
+	}
+	expectedJobIDs := []string{"1", "2", "3", "6"}
+	sort.Strings(jobIDs)
+	if !reflect.DeepEqual(jobIDs, expectedJobIDs) {
+		t.Errorf("Unexpected value for jobIDs\nExpected %v\nGot %v\n", expectedJobIDs, jobIDs)
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	cache, err := newInformerCache(clientset, newMetadataClient(clientset), []string{metav1.NamespaceAll}, stopCh, logger)
+	if err != nil {
+		t.Fatalf("Unexpected error starting informers: %v", err)
+	}
+	objectCache = cache
+	defer func() { objectCache = nil }()
+
+	err = run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 2 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	expectedExpiry, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 16:00:00")
+	if !nextExpiry.Equal(expectedExpiry) {
+		t.Errorf("Unexpected next expiry\nExpected %v\nGot %v", expectedExpiry, nextExpiry)
+	}
+
+	expected := `
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 3
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 2
+	job_pod_reaper_reaped_total{reason="orphaned",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ondemand-job6",
+			Namespace: "user-user1",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1h",
+			},
+			Labels:            map[string]string{"job": "6"},
+			CreationTimestamp: podStartTime,
+		},
+	}
+	for i := 0; i < 50; i++ {
+		pods, _ := listPods(context.TODO(), clientset, metav1.NamespaceAll, metav1.ListOptions{}, logger)
+		if len(pods) == 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	select {
+	case <-cache.wake:
+	default:
+	}
+	unlabeled := pod.DeepCopy()
+	unlabeled.Name = "unlabeled"
+	unlabeled.Labels = nil
+	if _, err := clientset.CoreV1().Pods("user-user1").Create(context.TODO(), unlabeled, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Unexpected error creating pod: %v", err)
+	}
+	select {
+	case <-cache.wake:
+		t.Errorf("Expected pod without job label to not wake reaper")
+	case <-time.After(500 * time.Millisecond):
+	}
+	if _, err := clientset.CoreV1().Pods("user-user1").Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("Unexpected error creating pod: %v", err)
+	}
+	select {
+	case <-cache.wake:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected pod change to wake reaper")
+	}
+	for i := 0; i < 50; i++ {
+		pods, _ := listPods(context.TODO(), clientset, "user-user1", metav1.ListOptions{LabelSelector: "job=6"}, logger)
+		if len(pods) == 1 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{metav1.NamespaceAll}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].podName != "ondemand-job6" {
+		t.Errorf("Expected new pod to be expired from cache, got: %v", jobs)
+	}
+
+	deletionTimestamp := metav1.NewTime(timeNow())
+	pod.DeletionTimestamp = &deletionTimestamp
+	if _, err := clientset.CoreV1().Pods("user-user1").Update(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Unexpected error updating pod: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		pods, _ := listPods(context.TODO(), clientset, "user-user1", metav1.ListOptions{LabelSelector: "job=6"}, logger)
+		if len(pods) == 1 && pods[0].DeletionTimestamp != nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	err = run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total"); err != nil {
+		t.Errorf("Expected pod being deleted to not be reaped again:\n%s", err)
+	}
+}
+
+func TestRunMetadata(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for _, action := range clientset.(*fake.Clientset).Actions() {
+		if action.GetVerb() == "list" && action.GetResource().Resource != "pods" && action.GetResource().Resource != "namespaces" {
+			t.Errorf("Unexpected list of full %s objects", action.GetResource().Resource)
+		}
+	}
+
+	expected := `
+	# HELP job_pod_reaper_errors_total Total number of errors
+	# TYPE job_pod_reaper_errors_total counter
+	job_pod_reaper_errors_total 0
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 3
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 2
+	job_pod_reaper_reaped_total{reason="orphaned",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total", "job_pod_reaper_errors_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	cache, err := newInformerCache(clientset, newMetadataClient(clientset), []string{metav1.NamespaceAll}, stopCh, logger)
+	if err != nil {
+		t.Fatalf("Unexpected error starting informers: %v", err)
+	}
+	objectCache = cache
+	defer func() { objectCache = nil }()
+	cached, err := listObjectMetadata(context.TODO(), newMetadataClient(clientset), "service", "user-user1", metav1.ListOptions{LabelSelector: "job"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	names := []string{}
+	for _, object := range cached {
+		names = append(names, object.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"service-user1-job5"}) {
+		t.Errorf("Unexpected cached services, got: %v", names)
+	}
+	cached, err = listObjectMetadata(context.TODO(), newMetadataClient(clientset), "secret", "user-user2", metav1.ListOptions{LabelSelector: "job"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(cached) != 0 {
+		t.Errorf("Expected reaped secrets to not be cached, got: %v", cached)
+	}
+}
+
+func TestPodChanged(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pod",
+			Annotations: map[string]string{"pod.kubernetes.io/lifetime": "1h"},
+			Labels:      map[string]string{"job": "1"},
+		},
+	}
+	warned := pod.DeepCopy()
+	warned.Annotations["job-pod-reaper/expires-in"] = "5m0s"
+	if podChanged(pod, warned) {
+		t.Errorf("Expected expires-in annotation to not change pod")
+	}
+	extended := warned.DeepCopy()
+	extended.Annotations["job-pod-reaper/extend-by"] = "1h"
+	if !podChanged(warned, extended) {
+		t.Errorf("Expected extend-by annotation to change pod")
+	}
+	failed := pod.DeepCopy()
+	failed.Status.Phase = v1.PodFailed
+	if !podChanged(pod, failed) {
+		t.Errorf("Expected status to change pod")
+	}
+}
+
+func TestInformerCacheReapable(t *testing.T) {
+	cache := &informerCache{}
+	cache.setPodFilter("job", "app=ondemand,app=jupyter")
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "pod",
+			Labels: map[string]string{"job": "1", "app": "ondemand"},
+		},
+	}
+	if !cache.reapable(pod) {
+		t.Errorf("Expected pod with job and object labels to be reapable")
+	}
+	noJob := pod.DeepCopy()
+	delete(noJob.Labels, "job")
+	if cache.reapable(noJob) {
+		t.Errorf("Expected pod without job label to not be reapable")
+	}
+	other := pod.DeepCopy()
+	other.Labels["app"] = "other"
+	if cache.reapable(other) {
+		t.Errorf("Expected pod not matching object labels to not be reapable")
+	}
+	cache.setPodFilter("none", "")
+	if !cache.reapable(noJob) {
+		t.Errorf("Expected pod without job label to be reapable with job label none")
+	}
+}
+
+func TestRunReapWorkers(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--reap-workers=3"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	var lock sync.Mutex
+	deletes := make(map[string][]string)
+	clientset.(*fake.Clientset).PrependReactor("delete", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		deletes[action.GetNamespace()] = append(deletes[action.GetNamespace()], action.GetResource().Resource)
+		return false, nil, nil
+	})
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	for namespace, resources := range deletes {
+		seenOther := false
+		for _, resource := range resources {
+			if resource != "pods" {
+				seenOther = true
+			} else if seenOther {
+				t.Errorf("Expected pods to be deleted first in namespace %s, got: %v", namespace, resources)
+			}
+		}
+	}
+	if len(deletes["user-user1"]) != 4 || len(deletes["user-user2"]) != 7 || len(deletes["user-user3"]) != 1 {
+		t.Errorf("Unexpected deletes, got: %v", deletes)
+	}
+
+	expected := `
+	# HELP job_pod_reaper_reaped_total Total number of object types reaped
+	# TYPE job_pod_reaper_reaped_total counter
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 3
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 2
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 2
+	job_pod_reaper_reaped_total{reason="orphaned",type="configmap"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="secret"} 1
+	job_pod_reaper_reaped_total{reason="orphaned",type="service"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_reaped_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestRunLeaderElection(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--leader-elect", "--leader-election-namespace=job-pod-reaper"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- runLeaderElection(ctx, clientset, newMetadataClient(clientset), make(chan os.Signal, 1), logger)
+	}()
+	for i := 0; i < 50; i++ {
+		pods, _ := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+		if len(pods.Items) == 2 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if val := testutil.ToFloat64(metricLeader); val != 1 {
+		t.Errorf("Expected replica to be leader, got: %v", val)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 2 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	lease, err := clientset.CoordinationV1().Leases("job-pod-reaper").Get(context.TODO(), "job-pod-reaper", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting lease: %v", err)
+	}
+	hostname, _ := os.Hostname()
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != hostname {
+		t.Errorf("Unexpected lease holder, got: %v", lease.Spec.HolderIdentity)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected leader election to stop")
+	}
+	if val := testutil.ToFloat64(metricLeader); val != 0 {
+		t.Errorf("Expected replica to no longer be leader, got: %v", val)
+	}
+}
+
+func TestRunLeaderElectionFollower(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--leader-elect", "--leader-election-namespace=job-pod-reaper"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	resetCounters()
+	clientset := clientset()
+	holder := "other-replica"
+	leaseDuration := int32(60)
+	_, err := clientset.CoordinationV1().Leases("job-pod-reaper").Create(context.TODO(), &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "job-pod-reaper", Namespace: "job-pod-reaper"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &leaseDuration,
+			AcquireTime:          &metav1.MicroTime{Time: time.Now()},
+			RenewTime:            &metav1.MicroTime{Time: time.Now()},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error creating lease: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := runLeaderElection(ctx, clientset, newMetadataClient(clientset), make(chan os.Signal, 1), logger); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if val := testutil.ToFloat64(metricLeader); val != 0 {
+		t.Errorf("Expected replica to be follower, got: %v", val)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 5 {
+		t.Errorf("Expected follower to not reap pods, got: %d", len(pods.Items))
+	}
+}
+
+func TestRunShutdown(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupted := false
+	clientset.(*fake.Clientset).PrependReactor("delete", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if !interrupted {
+			interrupted = true
+			cancel()
+		}
+		return false, nil, nil
+	})
+	err := run(ctx, clientset, newMetadataClient(clientset), logger)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected run to be interrupted, got: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 4 {
+		t.Errorf("Expected deletion in progress to finish and others to be skipped, got %d pods", len(pods.Items))
+	}
+
+	if err := reapLoop(ctx, clientset, newMetadataClient(clientset), make(chan os.Signal, 1), logger); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected final run to be interrupted, got: %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- reapLoop(ctx, clientset, newMetadataClient(clientset), make(chan os.Signal, 1), logger)
+	}()
+	for i := 0; i < 50 && testutil.ToFloat64(metricError) != 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected final run to be completed, got: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected reap loop to stop")
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--run-once", "--run-timeout=100ms"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	clientset.(*fake.Clientset).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(200 * time.Millisecond)
+		return false, nil, nil
+	})
+	err := reapLoop(context.Background(), clientset, newMetadataClient(clientset), make(chan os.Signal, 1), logger)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected run to exceed deadline, got: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 5 {
+		t.Errorf("Expected aborted run to not reap pods, got %d pods", len(pods.Items))
+	}
+
+	expected := `
+	# HELP job_pod_reaper_error Indicates an error was encountered
+	# TYPE job_pod_reaper_error gauge
+	job_pod_reaper_error 1
+	# HELP job_pod_reaper_runs_aborted_total Total number of runs aborted after exceeding the run timeout
+	# TYPE job_pod_reaper_runs_aborted_total counter
+	job_pod_reaper_runs_aborted_total 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_error", "job_pod_reaper_runs_aborted_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	metricError.Set(0)
+}
+
+func TestRunDeleteRetries(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--run-once", "--retry-backoff=10ms"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	metricDeleteRetriesTotal.Reset()
+	errorsTotal := testutil.ToFloat64(metricErrorsTotal)
+	clientset := clientset()
+	attempts := make(map[string]int)
+	clientset.(*fake.Clientset).PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(k8stesting.DeleteAction)
+		attempts[deleteAction.GetName()]++
+		switch len(attempts) {
+		case 1:
+			if attempts[deleteAction.GetName()] == 1 {
+				return true, nil, apierrors.NewServiceUnavailable("unavailable")
+			}
+		case 2:
+			if err := clientset.(*fake.Clientset).Tracker().Delete(action.GetResource(), action.GetNamespace(), deleteAction.GetName()); err != nil {
+				t.Errorf("Unexpected error deleting pod: %v", err)
+			}
+			return true, nil, apierrors.NewNotFound(action.GetResource().GroupResource(), deleteAction.GetName())
+		}
+		return false, nil, nil
+	})
+	err := reapLoop(context.Background(), clientset, newMetadataClient(clientset), make(chan os.Signal, 1), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 2 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	if val := testutil.ToFloat64(metricErrorsTotal); val != errorsTotal {
+		t.Errorf("Expected no errors, got %v", val-errorsTotal)
+	}
+
+	expected := `
+	# HELP job_pod_reaper_delete_retries_total Total number of deletions retried after transient errors
+	# TYPE job_pod_reaper_delete_retries_total counter
+	job_pod_reaper_delete_retries_total{type="pod"} 1
+	# HELP job_pod_reaper_error Indicates an error was encountered
+	# TYPE job_pod_reaper_error gauge
+	job_pod_reaper_error 0
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_delete_retries_total", "job_pod_reaper_error"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+	if val := testutil.ToFloat64(metricReapedTotal.WithLabelValues("pod", "lifetime")); val != 2 {
+		t.Errorf("Expected 2 pods reaped, got %v", val)
+	}
+
+	if delay := retryDelay(apierrors.NewTooManyRequests("slow down", 5), 0); delay != 5*time.Second {
+		t.Errorf("Expected Retry-After delay of 5s, got %v", delay)
+	}
+	if delay := retryDelay(apierrors.NewServiceUnavailable("unavailable"), 2); delay != 40*time.Millisecond {
+		t.Errorf("Expected backoff delay of 40ms, got %v", delay)
+	}
+	if isRetryable(apierrors.NewNotFound(v1.Resource("pods"), "test")) {
+		t.Errorf("Expected NotFound to not be retryable")
+	}
+}
+
+func TestRunPreconditions(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--run-once"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	errorsTotal := testutil.ToFloat64(metricErrorsTotal)
+	clientset := clientset()
+	tracker := clientset.(*fake.Clientset).Tracker()
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error getting pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		pod.UID = types.UID(pod.Namespace + "/" + pod.Name)
+		if err := tracker.Update(v1.SchemeGroupVersion.WithResource("pods"), &pod, pod.Namespace); err != nil {
+			t.Fatalf("Unexpected error updating pod: %v", err)
+		}
+	}
+	replaced := ""
+	clientset.(*fake.Clientset).PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		deleteAction := action.(k8stesting.DeleteAction)
+		obj, err := tracker.Get(action.GetResource(), action.GetNamespace(), deleteAction.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*v1.Pod)
+		if replaced == "" {
+			replaced = pod.Name
+			pod.UID = "recreated"
+			if err := tracker.Update(action.GetResource(), pod, pod.Namespace); err != nil {
+				t.Errorf("Unexpected error updating pod: %v", err)
+			}
+		}
+		preconditions := deleteAction.GetDeleteOptions().Preconditions
+		if preconditions == nil || preconditions.UID == nil {
+			t.Errorf("Expected UID precondition deleting pod %s", pod.Name)
+		} else if *preconditions.UID != pod.UID {
+			return true, nil, apierrors.NewConflict(action.GetResource().GroupResource(), pod.Name, errors.New("UID precondition failed"))
+		}
+		return false, nil, nil
+	})
+	err = reapLoop(context.Background(), clientset, newMetadataClient(clientset), make(chan os.Signal, 1), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err = clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 3 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	for _, pod := range pods.Items {
+		if pod.Name == replaced && pod.UID != "recreated" {
+			t.Errorf("Expected recreated pod %s to not be reaped", pod.Name)
+		}
+	}
+	if val := testutil.ToFloat64(metricErrorsTotal); val != errorsTotal {
+		t.Errorf("Expected no errors, got %v", val-errorsTotal)
+	}
+	if val := testutil.ToFloat64(metricReapedTotal.WithLabelValues("pod", "lifetime")); val != 2 {
+		t.Errorf("Expected 2 pods reaped, got %v", val)
+	}
+	if val := testutil.ToFloat64(metricError); val != 0 {
+		t.Errorf("Expected error metric to be 0, got %v", val)
+	}
+}
+
+func TestRunNoJobLabel(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--job-label=none"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	resetCounters()
+	clientset := clientset()
+	err := run(context.TODO(), clientset, newMetadataClient(clientset), logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting pods: %v", err)
+	}
+	if len(pods.Items) != 1 {
+		t.Errorf("Unexpected number of pods, got: %d", len(pods.Items))
+	}
+	services, err := clientset.CoreV1().Services(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Errorf("Unexpected error getting services: %v", err)
+	}
+	if len(services.Items) != 4 {
+		t.Errorf("Unexpected number of services, got: %d", len(services.Items))
+	}
+	configmaps, err := clientset.CoreV1().ConfigMaps(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
 		t.Errorf("Unexpected error getting configmaps: %v", err)
 	}
 	if len(configmaps.Items) != 3 {
@@ -607,10 +2944,10 @@ func TestRunNoJobLabel(t *testing.T) {
 	job_pod_reaper_errors_total 0
 	# HELP job_pod_reaper_reaped_total Total number of object types reaped
 	# TYPE job_pod_reaper_reaped_total counter
-	job_pod_reaper_reaped_total{type="configmap"} 0
-	job_pod_reaper_reaped_total{type="pod"} 4
-	job_pod_reaper_reaped_total{type="secret"} 0
-	job_pod_reaper_reaped_total{type="service"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="configmap"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="pod"} 4
+	job_pod_reaper_reaped_total{reason="lifetime",type="secret"} 0
+	job_pod_reaper_reaped_total{reason="lifetime",type="service"} 0
 	`
 
 	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
@@ -666,7 +3003,7 @@ func TestOrphanedFutureResourcesIgnored(t *testing.T) {
 	}
 	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
 
-	orphanedObjects, err := getOrphanedJobObjects(clientset, []podJob{}, []string{}, []string{"future"}, logger)
+	orphanedObjects, err := getOrphanedJobObjects(context.TODO(), newMetadataClient(clientset), []podJob{}, []string{}, []string{"future"}, logger)
 
 	if err != nil {
 		t.Errorf("Not supposed to have error during orphaned job calculation: %v", err)
@@ -677,10 +3014,260 @@ func TestOrphanedFutureResourcesIgnored(t *testing.T) {
 	}
 }
 
+func TestGetJobsAnnotationErrors(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	metricAnnotationErrorsTotal.Reset()
+	clientset := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lifetime-days",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1d",
+			},
+			Labels:            map[string]string{"job": "1"},
+			CreationTimestamp: metav1.NewTime(podStart.Add(-24 * time.Hour)),
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lifetime-invalid",
+			Namespace: "test",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/lifetime": "1 day",
+			},
+			Labels:            map[string]string{"job": "2"},
+			CreationTimestamp: podStartTime,
+		},
+	}, &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "expires-at-invalid",
+			Namespace: "test2",
+			Annotations: map[string]string{
+				"pod.kubernetes.io/expires-at": "tomorrow",
+			},
+			Labels:            map[string]string{"job": "3"},
+			CreationTimestamp: podStartTime,
+		},
+	})
+
+	jobs, _, _, err := getJobs(context.TODO(), clientset, []string{"test", "test2"}, logger)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Errorf("Expected 1 jobs, got %d", len(jobs))
+		return
+	}
+	if val := jobs[0].jobID; val != "1" {
+		t.Errorf("Unexpected jobID, got: %v", val)
+	}
+
+	expected := `
+	# HELP job_pod_reaper_annotation_errors_total Total number of pod annotations that could not be parsed
+	# TYPE job_pod_reaper_annotation_errors_total counter
+	job_pod_reaper_annotation_errors_total{annotation="pod.kubernetes.io/expires-at",namespace="test2"} 1
+	job_pod_reaper_annotation_errors_total{annotation="pod.kubernetes.io/lifetime",namespace="test"} 1
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_annotation_errors_total"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+}
+
+func TestLimitJobObjectsInvalidAnnotation(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--namespace-reap-max=all=2"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	errorsTotal := testutil.ToFloat64(metricErrorsTotal)
+	jobObjects := []jobObject{}
+	for _, name := range []string{"job1", "job2", "job3"} {
+		jobObjects = append(jobObjects, jobObject{objectType: "pod", jobID: name, name: name, namespace: "test", reason: reasonLifetime})
+	}
+	nsAnnotations := map[string]map[string]string{
+		"test": {"job-pod-reaper/reap-max": "many"},
+	}
+	limitedObjects := limitJobObjects(jobObjects, nsAnnotations, logger)
+	if len(limitedObjects) != 2 {
+		t.Errorf("Expected namespace budget of 2 to be used, got %d objects", len(limitedObjects))
+	}
+	if val := testutil.ToFloat64(metricErrorsTotal); val != errorsTotal+1 {
+		t.Errorf("Expected invalid annotation to be counted once, got %v", val-errorsTotal)
+	}
+	if _, err := parseBudgets("pods=5", reapTypes); err == nil {
+		t.Errorf("Expected error parsing budget for unknown type")
+	}
+}
+
+func TestReapLeadershipLost(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--retry-backoff=500ms"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	for _, cause := range []error{context.Canceled, errLeadershipLost} {
+		clientset := clientset()
+		ctx, cancel := context.WithCancelCause(context.Background())
+		clientset.(*fake.Clientset).PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if ctx.Err() == nil {
+				cancel(cause)
+				return true, nil, apierrors.NewServiceUnavailable("unavailable")
+			}
+			return false, nil, nil
+		})
+		jobObjects := []jobObject{{objectType: "pod", jobID: "1", name: "ondemand-job1", namespace: "user-user1", reason: reasonLifetime}}
+		errCount, _ := reap(ctx, clientset, jobObjects, logger)
+		exists := objectExists(clientset, "pod", "user-user1", "ondemand-job1")
+		if cause == errLeadershipLost && (errCount != 1 || !exists) {
+			t.Errorf("Expected deletion in progress to be cancelled when leadership is lost, got %d errors", errCount)
+		}
+		if cause != errLeadershipLost && (errCount != 0 || exists) {
+			t.Errorf("Expected deletion in progress to finish when shutting down, got %d errors", errCount)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if _, err := kingpin.CommandLine.Parse([]string{"--config-file=" + file, "--reap-max=10", "--job-label=app"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	flagDefaults = getFlagValues()
+	defer func() { flagDefaults = nil }()
+	metricConfigReloadsTotal.Reset()
+
+	config := `
+reap-namespaces: [user-user1, user-user2]
+object-labels: app.kubernetes.io/managed-by=open-ondemand
+reap-max: 20
+reap-job-pods: true
+`
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(logger); err != nil {
+		t.Fatalf("Unexpected error reloading config: %v", err)
+	}
+	if *reapNamespaces != "user-user1,user-user2" {
+		t.Errorf("Unexpected reap-namespaces, got: %s", *reapNamespaces)
+	}
+	if *objectLabels != "app.kubernetes.io/managed-by=open-ondemand" {
+		t.Errorf("Unexpected object-labels, got: %s", *objectLabels)
+	}
+	if *reapMax != 20 || !*reapJobPods || *jobLabel != "app" {
+		t.Errorf("Unexpected flags, got reap-max=%d reap-job-pods=%v job-label=%s", *reapMax, *reapJobPods, *jobLabel)
+	}
+
+	if err := os.WriteFile(file, []byte("reap-max: 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(logger); err != nil {
+		t.Fatalf("Unexpected error reloading config: %v", err)
+	}
+	if *reapNamespaces != "all" || *reapMax != 5 || *reapJobPods {
+		t.Errorf("Expected removed settings to revert, got reap-namespaces=%s reap-max=%d reap-job-pods=%v", *reapNamespaces, *reapMax, *reapJobPods)
+	}
+
+	for _, config := range []string{"reap-max: many\n", "listen-address: :9090\n", "namespace-reap-max: all\n", "type-reap-max: pods=5\n", "policy-file: " + filepath.Join(dir, "missing.yaml") + "\n"} {
+		if err := os.WriteFile(file, []byte("reap-interval: 1m\n"+config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := reloadConfig(logger); err == nil {
+			t.Errorf("Expected error reloading config %q", config)
+		}
+		if *reapMax != 5 || *reapInterval != 60*time.Second || *policyFile != "" {
+			t.Errorf("Expected previous config to be kept after %q, got reap-max=%d reap-interval=%s policy-file=%s", config, *reapMax, *reapInterval, *policyFile)
+		}
+	}
+
+	expected := `
+	# HELP job_pod_reaper_config_last_reload_successful Indicates the last configuration reload was successful
+	# TYPE job_pod_reaper_config_last_reload_successful gauge
+	job_pod_reaper_config_last_reload_successful 0
+	# HELP job_pod_reaper_config_reloads_total Total number of configuration reloads
+	# TYPE job_pod_reaper_config_reloads_total counter
+	job_pod_reaper_config_reloads_total{result="failure"} 5
+	job_pod_reaper_config_reloads_total{result="success"} 2
+	`
+
+	if err := testutil.GatherAndCompare(metricGathers(), strings.NewReader(expected),
+		"job_pod_reaper_config_reloads_total", "job_pod_reaper_config_last_reload_successful"); err != nil {
+		t.Errorf("unexpected collecting result:\n%s", err)
+	}
+
+	if _, err := kingpin.CommandLine.Parse([]string{}); err != nil {
+		t.Fatal(err)
+	}
+	flagDefaults = getFlagValues()
+	if err := reloadConfig(logger); err != nil {
+		t.Fatalf("Unexpected error reloading config: %v", err)
+	}
+	if val := testutil.ToFloat64(metricConfigReloadsTotal.WithLabelValues("success")); val != 2 {
+		t.Errorf("Expected loading without config or policy file to not count as reload, got: %v", val)
+	}
+}
+
+func TestReapLoopReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte("reap-max: 20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kingpin.CommandLine.Parse([]string{"--config-file=" + file, "--reap-interval=1h"}); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	flagDefaults = getFlagValues()
+	defer func() { flagDefaults = nil }()
+	configChecksum = getConfigChecksum()
+	metricConfigReloadsTotal.Reset()
+
+	timeNow = func() time.Time {
+		t, _ := time.Parse("01/02/2006 15:04:05", "01/01/2020 15:00:00")
+		return t
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	hup := make(chan os.Signal, 1)
+	done := make(chan error)
+	clientset := clientset()
+	go func() { done <- reapLoop(ctx, clientset, newMetadataClient(clientset), hup, logger) }()
+	for i := 1; i <= 3; i++ {
+		hup <- syscall.SIGHUP
+		for j := 0; j < 50 && testutil.ToFloat64(metricConfigReloadsTotal.WithLabelValues("success")) < float64(i); j++ {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if val := testutil.ToFloat64(metricConfigReloadsTotal.WithLabelValues("success")); val != float64(i) {
+			t.Errorf("Expected SIGHUP %d to reload configuration, got %v reloads", i, val)
+		}
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected reap loop to return when cancelled")
+	}
+}
+
 func resetCounters() {
 	metricReapedTotal.Reset()
-	metricReapedTotal.WithLabelValues("pod")
-	metricReapedTotal.WithLabelValues("service")
-	metricReapedTotal.WithLabelValues("configmap")
-	metricReapedTotal.WithLabelValues("secret")
+	metricReapedTotal.WithLabelValues("pod", "lifetime")
+	metricReapedTotal.WithLabelValues("service", "lifetime")
+	metricReapedTotal.WithLabelValues("configmap", "lifetime")
+	metricReapedTotal.WithLabelValues("secret", "lifetime")
 }